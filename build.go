@@ -111,6 +111,24 @@ func BuildPackage(targets map[string]*Action, pkg *Package) (*Action, error) {
 
 // Compile returns an Action representing the steps required to compile this package.
 func Compile(pkg *Package, deps ...*Action) (*Action, error) {
+	if !pkg.cacheable() {
+		return compile(pkg, deps...)
+	}
+
+	// step 0. when the action runs, fetch the compiled package from the
+	// cache, compiling it only if it is not present.
+	build, err := compile(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return &Action{
+		Name: fmt.Sprintf("fetch: %s", pkg.ImportPath),
+		Deps: deps,
+		Run:  fetchFn(build, pkg),
+	}, nil
+}
+
+func compile(pkg *Package, deps ...*Action) (*Action, error) {
 	var gofiles []string
 	gofiles = append(gofiles, pkg.GoFiles...)
 
@@ -190,6 +208,11 @@ func Compile(pkg *Package, deps ...*Action) (*Action, error) {
 		build = &pack
 	}
 
+	// should the compiled package be stored in the cache
+	if pkg.cacheable() {
+		build.Run = storeFn(build.Run, pkg)
+	}
+
 	// should this package be cached
 	if pkg.Install && !pkg.TestScope {
 		build = &Action{
@@ -0,0 +1,208 @@
+package gb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/constabulary/gb/internal/fileutils"
+	"github.com/pkg/errors"
+)
+
+// Cache stores the outputs of build actions, compiled package archives
+// and test results, addressed by an action key.
+type Cache interface {
+
+	// Get returns the contents stored under key. If key is not present
+	// Get returns an error.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put stores the contents of r under key.
+	Put(key string, r io.Reader) error
+}
+
+// WithCache configures the Context to fetch compiled packages from, and
+// store compiled packages in, cache.
+func WithCache(cache Cache) func(*Context) error {
+	return func(c *Context) error {
+		c.cache = cache
+		return nil
+	}
+}
+
+// Cache returns the Cache configured for this Context, or nil if the Context
+// has no Cache.
+func (c *Context) Cache() Cache { return c.cache }
+
+// ActionKey returns a key which identifies the inputs used to compile pkg.
+// Two packages with the same ActionKey produce the same archive.
+func (pkg *Package) ActionKey() (string, error) {
+	if pkg.actionKey != "" {
+		return pkg.actionKey, nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "gb %s\n", runtime.Version())
+	fmt.Fprintf(h, "ctx %s\n", pkg.ctxString())
+	fmt.Fprintf(h, "gcflags %q\n", pkg.gcflags)
+	fmt.Fprintf(h, "package %s %s\n", pkg.ImportPath, pkg.Name)
+	if pkg.TestScope {
+		fmt.Fprintf(h, "testscope\n")
+	}
+
+	// the standard library is fixed for a given Go version, so
+	// there is no need to hash its source.
+	if !pkg.Goroot {
+		fmt.Fprintf(h, "cgo %q %q %q %q %q\n", pkg.CgoCFLAGS, pkg.CgoCPPFLAGS, pkg.CgoCXXFLAGS, pkg.CgoLDFLAGS, pkg.CgoPkgConfig)
+		srcs := stringList(pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.SFiles, pkg.SysoFiles, pkg.SwigFiles, pkg.SwigCXXFiles)
+		for _, src := range srcs {
+			if err := hashFile(h, filepath.Join(pkg.Dir, src)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, dep := range pkg.Imports {
+		switch dep.ImportPath {
+		case "C", "unsafe":
+			fmt.Fprintf(h, "import %s\n", dep.ImportPath)
+			continue
+		}
+		key, err := dep.ActionKey()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "import %s %s\n", dep.ImportPath, key)
+	}
+	pkg.actionKey = fmt.Sprintf("%x", h.Sum(nil))
+	return pkg.actionKey, nil
+}
+
+// hashFile writes the name and contents of path to w.
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to hash file")
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "file %s %d\n", filepath.Base(path), fi.Size())
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// cacheable returns true if the compiled archive of pkg can be stored in
+// the Context's Cache.
+func (pkg *Package) cacheable() bool {
+	if pkg.cache == nil || pkg.Main || pkg.TestScope {
+		return false
+	}
+	switch pkg.ImportPath {
+	case "C", "unsafe":
+		return false
+	}
+	return true
+}
+
+// fetchFn returns a function which installs the archive of pkg retrieved
+// from the Context's Cache or, if it is not present in the cache, executes
+// build to compile it.
+func fetchFn(build *Action, pkg *Package) func() error {
+	return func() error {
+		if !fetch(pkg) {
+			return Execute(build)
+		}
+		if pkg.Install {
+			if err := fileutils.Copyfile(pkg.installpath(), pkg.objfile()); err != nil {
+				return err
+			}
+		}
+		fmt.Println(pkg.ImportPath)
+		return nil
+	}
+}
+
+// fetch writes the archive of pkg retrieved from the Context's Cache to its
+// object file, reporting whether it was present in the cache.
+func fetch(pkg *Package) bool {
+	key, err := pkg.ActionKey()
+	if err != nil {
+		pkg.debug("cache: %s: %v", pkg.ImportPath, err)
+		return false
+	}
+	rc, err := pkg.cache.Get(key)
+	if err != nil {
+		pkg.debug("cache: miss %s: %v", pkg.ImportPath, err)
+		return false
+	}
+	defer rc.Close()
+	if err := writeFile(pkg.objfile(), rc); err != nil {
+		pkg.debug("cache: %s: %v", pkg.ImportPath, err)
+		return false
+	}
+	pkg.debug("cache: hit %s %s", pkg.ImportPath, key)
+	return true
+}
+
+// storeFn returns a function which runs fn then stores the archive of pkg
+// in the Context's Cache. Failure to store the archive is reported, but
+// does not fail the build.
+func storeFn(fn func() error, pkg *Package) func() error {
+	key, err := pkg.ActionKey()
+	if err != nil {
+		pkg.debug("cache: %s: %v", pkg.ImportPath, err)
+		return fn
+	}
+	return func() error {
+		if err := fn(); err != nil {
+			return err
+		}
+		f, err := os.Open(pkg.objfile())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pkg.cache.Put(key, f); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: unable to store %s in cache: %v\n", pkg.ImportPath, err)
+		}
+		return nil
+	}
+}
+
+// writeFile writes the contents of r to path, creating the parent
+// directory if required. The contents are written to a temporary file
+// beside path which is renamed into place once complete, so a concurrent
+// reader never sees a partial file.
+func writeFile(path string, r io.Reader) error {
+	if err := mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package gb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memcache is an in memory Cache.
+type memcache map[string][]byte
+
+func (m memcache) Get(key string) (io.ReadCloser, error) {
+	b, ok := m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memcache) Put(key string, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	m[key] = b
+	return err
+}
+
+func TestActionKey(t *testing.T) {
+	key := func(opts ...func(*Context) error) string {
+		ctx := testContext(t, opts...)
+		defer ctx.Destroy()
+		pkg, err := ctx.ResolvePackage("b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := pkg.ActionKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	k1, k2 := key(), key()
+	if k1 != k2 {
+		t.Errorf("ActionKey: expected stable key, got %q and %q", k1, k2)
+	}
+	if k3 := key(Gcflags("-N")); k3 == k1 {
+		t.Errorf("ActionKey: expected -gcflags to change key %q", k1)
+	}
+	if k4 := key(Tags("foo")); k4 == k1 {
+		t.Errorf("ActionKey: expected -tags to change key %q", k1)
+	}
+}
+
+func TestCompileFetchesFromCache(t *testing.T) {
+	cache := make(memcache)
+	ctx := testContext(t, WithCache(cache))
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := pkg.ActionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache[key] = []byte("!<arch>\n")
+
+	// the cache is consulted when the action runs, not when it is created.
+	a, err := Compile(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "fetch: a"; a.Name != want {
+		t.Fatalf("Compile(%v): want %q, got %q", pkg.ImportPath, want, a.Name)
+	}
+	if _, err := os.Stat(pkg.objfile()); !os.IsNotExist(err) {
+		t.Fatalf("Compile(%v): archive written before the action ran", pkg.ImportPath)
+	}
+	if err := Execute(a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(pkg.objfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, cache[key]) {
+		t.Fatalf("Compile(%v): expected archive fetched from cache, got %q", pkg.ImportPath, got)
+	}
+}
+
+// failingReader returns some content, then an error.
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n > 0 {
+		return 0, errors.New("read failed")
+	}
+	r.n = copy(p, "partial")
+	return r.n, nil
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := mktemp(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pkg", "a.a")
+
+	if err := writeFile(path, strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	// a failed write leaves the previous contents in place.
+	if err := writeFile(path, &failingReader{}); err == nil {
+		t.Fatal("writeFile: expected error")
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "first" {
+		t.Fatalf("writeFile: want %q, got %q", "first", got)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("writeFile: want only %s, got %d files", path, len(files))
+	}
+}
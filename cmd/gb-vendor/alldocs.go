@@ -16,6 +16,7 @@ The commands are:
         delete      deletes a local dependency
         purge       purges all unreferenced dependencies
         restore     restore dependencies from the manifest
+        nested      reports vendor directories nested inside dependencies
 
 Use "gb vendor help [command]" for more information about a command.
 
@@ -129,5 +130,28 @@ Flags:
 		limit the amount of restoration jobs occurring at the same time.
 
 
+Reports vendor directories nested inside dependencies
+
+Usage:
+
+        gb vendor nested [-flatten]
+
+gb vendor nested lists the packages found in vendor directories nested inside
+the dependencies in $PROJECT/vendor/src, one per line, followed by the import
+path the package would have in $PROJECT/vendor/src.
+
+When building a dependency, gb resolves its imports using its own nested
+vendor directories first, so these packages are used in preference to the
+copies in $PROJECT/vendor/src. Packages are marked "conflict" if
+$PROJECT/vendor/src already contains a package at the same import path.
+
+Flags:
+	-flatten
+		move the packages in nested vendor directories into
+		$PROJECT/vendor/src, then remove the nested vendor directories.
+		Conflicting packages are left in place, as is the nested vendor
+		directory containing them.
+
+
 */
 package main
@@ -26,6 +26,7 @@ var commands = []*cmd.Command{
 	cmdDelete,
 	cmdPurge,
 	cmdRestore,
+	cmdNested,
 }
 
 func main() {
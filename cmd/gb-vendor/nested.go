@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/internal/fileutils"
+	"github.com/pkg/errors"
+)
+
+var (
+	// gb vendor nested flags
+
+	// move nested packages into $PROJECT/vendor/src
+	flatten bool
+)
+
+func addNestedFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flatten, "flatten", false, "move nested packages into $PROJECT/vendor/src")
+}
+
+var cmdNested = &cmd.Command{
+	Name:      "nested",
+	UsageLine: "nested [-flatten]",
+	Short:     "reports vendor directories nested inside dependencies",
+	Long: `gb vendor nested lists the packages found in vendor directories nested inside
+the dependencies in $PROJECT/vendor/src, one per line, followed by the import
+path the package would have in $PROJECT/vendor/src.
+
+When building a dependency, gb resolves its imports using its own nested
+vendor directories first, so these packages are used in preference to the
+copies in $PROJECT/vendor/src. Packages are marked "conflict" if
+$PROJECT/vendor/src already contains a package at the same import path.
+
+Flags:
+	-flatten
+		move the packages in nested vendor directories into
+		$PROJECT/vendor/src, then remove the nested vendor directories.
+		Conflicting packages are left in place, as is the nested vendor
+		directory containing them.
+
+`,
+	Run: func(ctx *gb.Context, args []string) error {
+		srcdir := filepath.Join(ctx.Projectdir(), "vendor", "src")
+		pkgs, err := nestedPackages(srcdir)
+		if err != nil {
+			return err
+		}
+
+		conflicts := make(map[string]bool) // nested vendor directories with conflicts
+		for _, p := range pkgs {
+			dst := filepath.Join(srcdir, filepath.FromSlash(p.flat))
+			_, err := os.Stat(dst)
+			conflict := err == nil
+			if conflict {
+				conflicts[p.vendor] = true
+				fmt.Printf("%s\t%s\tconflict\n", p.path, p.flat)
+				continue
+			}
+			fmt.Printf("%s\t%s\n", p.path, p.flat)
+			if !flatten {
+				continue
+			}
+			if err := copyFiles(dst, filepath.Join(srcdir, filepath.FromSlash(p.path))); err != nil {
+				return errors.Wrapf(err, "could not flatten %s", p.path)
+			}
+		}
+
+		if !flatten {
+			return nil
+		}
+		removed := make(map[string]bool)
+		for _, p := range pkgs {
+			if conflicts[p.vendor] || removed[p.vendor] {
+				continue
+			}
+			removed[p.vendor] = true
+			if err := fileutils.RemoveAll(filepath.Join(srcdir, filepath.FromSlash(p.vendor))); err != nil {
+				return errors.Wrapf(err, "could not remove %s", p.vendor)
+			}
+		}
+		return nil
+	},
+	AddFlags: addNestedFlags,
+}
+
+// nestedPackage is a package inside a nested vendor directory.
+type nestedPackage struct {
+	path   string // import path relative to $PROJECT/vendor/src
+	flat   string // import path with the nested vendor directory removed
+	vendor string // the innermost vendor directory containing the package
+}
+
+// nestedPackages returns the packages in vendor directories below srcdir.
+func nestedPackages(srcdir string) ([]nestedPackage, error) {
+	var pkgs []nestedPackage
+	err := filepath.Walk(srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); path != srcdir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		i := strings.LastIndex(rel, "/vendor/")
+		if i < 0 {
+			return nil
+		}
+		gofiles, err := filepath.Glob(filepath.Join(path, "*.go"))
+		if err != nil || len(gofiles) == 0 {
+			return err
+		}
+		pkgs = append(pkgs, nestedPackage{
+			path:   rel,
+			flat:   rel[i+len("/vendor/"):],
+			vendor: rel[:i+len("/vendor")],
+		})
+		return nil
+	})
+	return pkgs, err
+}
+
+// copyFiles copies the files, but not the subdirectories, of src to dst.
+func copyFiles(dst, src string) error {
+	fis, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		if err := fileutils.Copyfile(filepath.Join(dst, fi.Name()), filepath.Join(src, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,28 +11,73 @@ Usage:
 The commands are:
 
         build       build a package
+        cache       manage the depfile download cache
+        cache-server run a remote build cache server
+        check       type check packages for many platforms
+        clean       remove build outputs
+        depfile     manage the depfile
         doc         show documentation for a package or symbol
         env         print project environment variables
+        fmt         format package sources
         generate    generate Go files by processing source
+        graph       print the import graph of packages
         info        info returns information about this project
         list        list the packages named by the importpaths
+        run         compile and run a program
         test        test packages
+        vet         report likely mistakes in packages
+        why         explain why a package is in the build
 
 Use "gb help [command]" for more information about a command.
 
 Additional help topics:
 
+        auth        credentials for private repositories
+        modules     using Go modules as dependencies
+        offline     building without network access
         plugin      plugin information
         project     gb project layout
 
 Use "gb help [topic]" for more information about that topic.
 
 
+Credentials for private repositories
+
+gb sends credentials when downloading depfile entries, when fetching the
+go-import metadata of import paths, and when probing and cloning git
+repositories over https, so private repositories and import servers can be
+used. The credentials for a host are taken from the first of these which
+has an entry for it:
+
+$GB_HOME/auth, in the same format as a depfile, with a token, or a user
+and password, for each host:
+
+	github.example.com token=0123456789abcdef
+	git.example.com user=builder password="s3cret phrase"
+
+An entry for host:port only applies to that port.
+
+GB_GITHUB_TOKEN, GB_GITLAB_TOKEN and GB_BITBUCKET_TOKEN, which hold a
+token for github.com, gitlab.com and bitbucket.org respectively, and their
+APIs. Setting GB_GITHUB_TOKEN also avoids the rate limit GitHub applies to
+anonymous requests, which gb makes to list the releases of version
+constraints.
+
+$NETRC, or ~/.netrc if it is not set, whose login and password are used
+for matching machine entries, and for the default entry.
+
+Tokens are sent as bearer tokens over HTTP. Git only supports basic
+authentication, so to git a token is sent as the password of the user in
+$GB_HOME/auth, or of the user the forge expects. Credentials are passed to
+git in its environment, and are not visible on its command line. Mercurial
+and bazaar repositories use their own configuration.
+
+
 Build a package
 
 Usage:
 
-        gb build [build flags] [packages]
+        gb build [build flags] [-o output] [-name template] [packages]
 
 Build compiles the packages named by the import paths, along with their
 dependencies.
@@ -66,6 +111,37 @@ Flags:
                 Supported only on linux/amd64, freebsd/amd64, darwin/amd64 and windows/amd64.
 	-tags 'tag list'
 		additional build tags.
+	-cache url
+		fetch compiled packages from, and store compiled packages in, the
+		remote build cache at url. Defaults to the value of $GB_CACHE.
+		See 'gb help cache-server'.
+	-allowinternal
+		allow packages inside an internal directory to be imported by
+		packages outside the tree rooted at the parent of that directory.
+		By default gb, like the go tool, rejects such imports.
+	-strict
+		fail if an import path is provided by more than one of GOROOT,
+		$PROJECT/src, $PROJECT/vendor/src, $GOPATH if enabled, the depfile
+		cache, required modules and depfile overrides, as only one of them
+		is used. See 'gb list -shadowed'.
+	-gopath
+		resolve packages not found in $PROJECT/src or $PROJECT/vendor/src
+		from each $GOPATH entry, in order, before the depfile cache. Packages
+		resolved from $GOPATH are listed in a warning, as they are not part
+		of the project. This can also be enabled for the project with the
+		depfile option 'gopath enabled=true'.
+	-o file
+		write the binary for the single main package being built to file.
+	-o dir/
+		write binaries to dir, rather than $PROJECT/bin. dir is treated as
+		a directory if it ends in a path separator or already exists.
+	-name 'template'
+		name binaries using the text/template, for example
+		'{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}'. The fields available are
+		.Name, the default name of the binary, .ImportPath, .GOOS, .GOARCH,
+		.Tags, the build tags joined with "-", and .Ext, which is ".exe" when
+		targeting windows. When a template is supplied, no suffix is added
+		to the name of the binary.
 
 The list flags accept a space-separated list of strings. To embed spaces in an
 element in the list, surround it with either single or double quotes.
@@ -73,6 +149,257 @@ element in the list, surround it with either single or double quotes.
 For more about where packages and binaries are installed, run 'gb help project'.
 
 
+Manage the depfile download cache
+
+Usage:
+
+        gb cache list | verify | prune [-unused-since age] | clean
+
+Cache manages $GB_HOME/cache, where the packages named in the depfiles of
+all projects are downloaded. Each directory of the cache holds one release,
+tag, archive or checkout of a package, and is recorded in the index
+$GB_HOME/cache/index when it is fetched, along with the sha256 of its
+content. The index also records when each directory was last used by gb.
+
+The subcommands are:
+
+	list
+		print the import path, source, size and date of last use of each
+		directory in the cache.
+	verify
+		hash the content of each directory in the cache again, and report
+		those which no longer match the sha256 recorded when they were
+		fetched.
+	prune [-unused-since age]
+		remove the directories which have not been used for age, 30d by
+		default. Age is a number of days, such as 30d, or a duration
+		such as 12h.
+	clean
+		remove the entire cache.
+
+Cache does not read the depfile of the project, so it neither fetches its
+entries nor records their use.
+
+Directories fetched by versions of gb which did not maintain the index are
+listed without an import path, are not verified, and are pruned by the time
+they were last modified.
+
+
+Run a remote build cache server
+
+Usage:
+
+        gb cache-server [-addr addr] -dir dir
+
+Cache-server runs a reference implementation of the remote build cache.
+
+Compiled package archives and test results are stored under their action
+key, which is derived from the package's source, its dependencies, and the
+build flags. Entries are stored with a PUT request to $URL/$KEY and fetched
+with a GET request to the same location.
+
+To use the cache, pass its url to gb build or gb test with the -cache flag
+or set $GB_CACHE:
+
+	% gb cache-server -addr :8080 -dir /var/cache/gb
+	% GB_CACHE=http://localhost:8080 gb build
+
+Flags:
+
+	-addr
+		the address to listen on, defaults to localhost:8080.
+	-dir
+		the directory in which cache entries are stored.
+
+
+Type check packages for many platforms
+
+Usage:
+
+        gb check [-os list] [-arch list] [-tagsets list] [-allowinternal] [-gopath] [packages]
+
+Check type checks the packages named by the import paths for each
+combination of target operating system, architecture and build tags,
+without compiling or linking them. For each combination the build
+constraints of every package, and its dependencies, are evaluated afresh,
+so files which are excluded on the host are checked too.
+
+Errors are reported with the platform they occur on, followed by a summary
+of the platforms each package fails on. Check exits with a non zero status
+if any package fails to type check.
+
+Flags:
+
+	-os 'list'
+		operating systems to check, for example 'linux darwin windows'.
+		Defaults to $GOOS, or the host operating system.
+	-arch 'list'
+		architectures to check, for example 'amd64 arm arm64'.
+		Defaults to $GOARCH, or the host architecture.
+	-tagsets 'list'
+		sets of build tags to check with, each set is comma separated,
+		for example 'netgo purego,noasm'. The -tags build flag is added
+		to each set. Defaults to the -tags build flag alone.
+	-allowinternal
+		do not enforce the visibility of internal packages.
+	-gopath
+		fall back to $GOPATH for packages not in the project.
+
+The list flags accept space or comma separated lists. Each platform is
+checked with the same depfile entries, modules and overrides as the
+project would be built with.
+
+
+Remove build outputs
+
+Usage:
+
+        gb clean [-a] [-bin] [-stale] [-cache] [-n]
+
+Clean removes build outputs from the project.
+
+By default clean removes the compiled packages for the current context,
+$PROJECT/pkg/$GOOS-$GOARCH[-tags], and any temporary files left in
+$PROJECT/bin by failed links.
+
+Flags:
+
+	-a
+		remove the compiled packages for all contexts, $PROJECT/pkg.
+	-bin
+		also remove compiled programs, $PROJECT/bin.
+	-stale
+		rather than removing the package cache for a context, remove only
+		those compiled packages which no longer correspond to a package in
+		$PROJECT/src, $PROJECT/vendor/src, $GOROOT/src, or the depfile
+		entries, modules and $GOPATH in use. Implies -a.
+	-cache
+		also remove the depfile download cache, $GB_HOME/cache.
+	-n
+		print the files and directories that would be removed, but do not
+		remove them.
+
+
+Manage the depfile
+
+Usage:
+
+        gb depfile add | set | remove | list | why | lock | update | override | download [arguments]
+
+Depfile manages $PROJECT/depfile, which names the packages gb downloads into
+$GB_HOME/cache, $PROJECT/depfile.lock and $PROJECT/depfile.local.
+
+The depfile.lock records the sha256 of the content of each entry in the
+depfile. When present, gb verifies the content of each entry, both when it
+is downloaded and on every build, so a release which is retagged upstream
+cannot silently change the build. An entry may also carry its own sha256
+key, which is verified in the same way. Once depfile.lock exists, every
+entry in use must be recorded in it; run gb depfile lock after adding one.
+Content which is not verified by depfile.lock, such as when it is written,
+is verified against the sha256 recorded when it was fetched into the cache,
+so content modified in the cache is never locked.
+
+The version of an entry may be a constraint rather than a single version,
+for example
+
+	github.com/pkg/errors version=^0.8.0
+	github.com/pkg/profile version=~1.2
+	github.com/pkg/sftp version=">=1.0.0 <2"
+
+Constraints are resolved to the highest release tagged vX.Y.Z upstream which
+satisfies them, and the release chosen is recorded in depfile.lock, so the
+build does not change until the entry is updated. Constraints are written
+^1.2.3 (>=1.2.3 <2.0.0), ~1.2.3 (>=1.2.3 <1.3.0), 1.2 or 1.2.x (>=1.2.0 <1.3.0),
+or with the comparisons >=, >, <=, < and =, separated by spaces or commas.
+
+A package fetched for the depfile may have a depfile of its own, at the top
+of its repository. Its entries are fetched in turn, and so on. When more
+than one depfile names the same package, and every entry names a version,
+an exact version such as 1.2.3 in $PROJECT/depfile is always used.
+Otherwise the highest version required is used; in the depfile of a
+dependency an exact version is a minimum, satisfied by any later compatible
+release, as if written ^1.2.3. Every entry must be satisfied by the version
+used, so a dependency which requires a later release than the project pins
+is reported as a conflict; write the project's entry as a constraint, such
+as ^1.2.3, to accept it.
+Entries which name a tag, archive URL or repository must all name the same
+content. Otherwise gb reports each conflicting entry, and the depfile which
+contains it, and stops.
+
+Some names are reserved for options of the project, rather than naming a
+package. The option
+
+	gopath enabled=true
+
+resolves packages not found in the project from $GOPATH, as gb build -gopath
+does. Options are set with gb depfile add and set like entries, but are not
+listed by gb depfile list, and are ignored in the depfiles of fetched
+packages.
+
+An entry with a path key, for example
+
+	github.com/pkg/errors version=0.8.0 path=../errors
+
+uses the package in the local directory, relative to $PROJECT, rather than
+downloading it, so a change to a dependency can be tried without publishing
+a release. Entries in $PROJECT/depfile.local, which is written by
+gb depfile override and is not meant to be committed, override the depfile
+in the same way. The depfile of an overridden package is still read, and an
+override is used in place of every entry naming its prefix. Overridden
+packages have the origin "override" in gb list, and are listed by gb info
+as GB_DEPFILE_OVERRIDES.
+
+Missing entries are fetched when the depfile is read, several at once; as
+many as the -P flag allows for commands which accept it. Each download is
+reported with its size, and requests which fail with a transient network or
+server error, including a connection lost during the download, are retried,
+with increasing delays; unknown hosts and other permanent errors are not.
+gb processes sharing $GB_HOME, such as parallel CI jobs, take a lock on each
+entry in the cache while fetching it, so an entry is fetched once and never
+read while it is incomplete. Entries may also be fetched from a local mirror, or
+never fetched at all; see gb help offline.
+
+The subcommands are:
+
+	add prefix key=value...
+		add an entry for prefix to the depfile.
+	set prefix key=value...
+		set keys of the entry for prefix; key= removes the key.
+	remove prefix...
+		remove the entries for the prefixes from the depfile.
+	list
+		print each entry in the depfile, followed by the packages in
+		the project which import a package it provides.
+	why prefix
+		print the shortest import chain from each package in the
+		project to a package provided by the entry for prefix.
+	lock
+		fetch each entry in the depfile and write depfile.lock,
+		replacing the hashes of any entries which have changed.
+	update [prefixes]
+		resolve the version constraints of the named entries, or all
+		entries, to the highest matching release, and write
+		depfile.lock.
+	override [prefix=dir | prefix]...
+		in $PROJECT/depfile.local, replace the content of prefix with
+		the directory dir, or remove the override of prefix. With no
+		arguments, print the overrides in use.
+	download dir
+		fetch each entry in use and write an archive of each to dir,
+		for use as GB_MIRROR; see gb help offline.
+
+Add and set check the entry before writing it: the version or tag of an
+entry downloaded from a forge must be tagged upstream, and a version
+constraint must match at least one release. The depfile is rewritten with
+its comments, blank lines and the order of its entries preserved. Add, set,
+remove and override do not fetch the entries of the depfile, so an entry
+which can no longer be fetched can still be changed, removed or overridden.
+
+List marks entries which are only imported by other dependencies as
+"(indirect)", and entries which nothing in the project imports as
+"(unused)".
+
+
 Show documentation for a package or symbol
 
 Usage:
@@ -94,6 +421,31 @@ Env prints project environment variables. If one or more variable names is
 given as arguments, env prints the value of each named variable on its own line.
 
 
+Format package sources
+
+Usage:
+
+        gb fmt [-check] [-imports] [packages]
+
+Fmt reformats the Go source files of the packages named by the import paths
+with the standard Go formatter, and prints the names of the files modified.
+
+Only packages in $PROJECT/src are formatted; $PROJECT/vendor/src is never
+modified. Files excluded by build constraints are formatted too.
+
+Flags:
+
+	-check
+		list the files which are not formatted, but do not modify them.
+		fmt exits with a non zero status if any files are listed.
+	-imports
+		also group each file's imports into blocks of standard library,
+		third party (vendored or depfile), and project packages, in that
+		order, sorting each block. Imports are classified using the same
+		resolver as 'gb build'. Import declarations containing comments
+		are left as they are.
+
+
 Generate Go files by processing source
 
 Usage:
@@ -108,6 +460,36 @@ source files, for instance by running yacc.
 See 'go help generate'.
 
 
+Print the import graph of packages
+
+Usage:
+
+        gb graph [-json] [-nostd] [-collapse prefixes] [packages]
+
+Graph prints the resolved import graph of the packages named by the import
+paths, and all of their dependencies, in DOT format.
+
+Each package is annotated with where it was resolved from, std, project,
+vendor, gopath, module, depfile or override, the size of its source files, and
+whether it uses cgo. Packages which use cgo are drawn with a double border.
+
+Imports between packages in different top level directories of $PROJECT/src
+which form a cycle between those directories, for example src/a/x imports
+src/b/y, and src/b/z imports src/a/w, are drawn in red. While not an import
+cycle yet, these are usually a sign that the directories should be merged
+or split differently.
+
+Flags:
+
+	-json
+		print the graph as JSON, rather than DOT.
+	-nostd
+		omit packages from the standard library.
+	-collapse 'prefixes'
+		merge all packages whose import path starts with one of the
+		prefixes into a single node named by the prefix.
+
+
 Info returns information about this project
 
 Usage:
@@ -128,6 +510,9 @@ Values:
 		The suffix applied any binary written to $GB_PROJECT_DIR/bin
 	GB_GOROOT
 		The value of runtime.GOROOT for the Go version that built this copy of gb.
+	GB_DEPFILE_OVERRIDES
+		The list of depfile entries replaced by local directories, each
+		written prefix=dir.
 
 info returns 0 if the project is well formed, and non zero otherwise.
 If one or more variable names is given as arguments, info prints the
@@ -138,7 +523,7 @@ List the packages named by the importpaths
 
 Usage:
 
-        gb list [-s] [-f format] [-json] [packages]
+        gb list [-s] [-f format] [-json] [-deps | -rdeps pkg] [-test] [-std] [-vendor] [-project] [-shadowed] [-gopath] [packages]
 
 List lists packages imported by the project.
 
@@ -163,6 +548,89 @@ Flags:
 	-json
 		prints output in structured JSON format. WARNING: gb.Package
 		structure is not stable and will change in the future!
+	-deps
+		list the named packages and all of their dependencies, direct or
+		indirect, in dependency order; each package is listed after the
+		packages it imports.
+	-rdeps pkg
+		list every package in $PROJECT/src which depends on pkg directly
+		or indirectly, wherever in the project gb is run. Any packages
+		named are ignored.
+	-test
+		with -deps or -rdeps, also follow the test imports of the packages
+		listed.
+	-std
+		list only packages from the standard library.
+	-vendor
+		list only packages from $PROJECT/vendor/src, $GOPATH, the depfile
+		cache, the module cache or a depfile override.
+	-project
+		list only packages from $PROJECT/src.
+	-shadowed
+		list only packages whose import path is provided by more than one
+		of GOROOT, $PROJECT/src, $PROJECT/vendor/src, $GOPATH if enabled,
+		the depfile cache, required modules and depfile overrides, each
+		followed by the directories providing it, the one in use
+		marked with a *. Usually combined with -deps. With -json the
+		directories are listed in the Shadows field.
+	-gopath
+		resolve packages not found in the project from $GOPATH, as
+		'gb build -gopath' does. Packages resolved from $GOPATH have the
+		origin "gopath", and are summarised in a warning.
+
+The -std, -vendor and -project filters may be combined, in which case
+packages matching any of them are listed.
+
+
+Using Go modules as dependencies
+
+gb can build packages from Go modules which are already present in the
+module cache, $GOMODCACHE, or $GOPATH/pkg/mod if it is not set.
+
+The modules used are those named by the require directives of
+$PROJECT/go.mod, and by depfile entries with a module key:
+
+	github.com/pkg/errors module=v0.8.0
+
+The replace and exclude directives are not supported, and are reported as
+errors rather than silently building different code to the go command.
+Other go.mod directives are ignored, as are the go.mod files of the
+required modules themselves; every module needed must be required by the
+project.
+
+An import path is resolved from the required module with the longest
+matching path, so github.com/user/lib/v2/pkg is found in the module
+github.com/user/lib/v2. Versions of v2 and above must match the major
+version suffix of the module path, unless marked +incompatible.
+
+If a module has not been extracted, but its zip file is present in the
+download cache of the module cache, or of $GB_HOME/mod, it is unpacked into
+$GB_HOME/mod. gb never downloads modules; use 'go mod download' to populate
+the module cache, after which builds work offline.
+
+
+Building without network access
+
+Setting GB_OFFLINE to any value other than 0, or passing the -offline flag
+to any command, disables network access. Depfile entries which are not in
+$GB_HOME/cache, or in the mirror named by GB_MIRROR, are reported as
+missing rather than fetched, as are the releases of version constraints
+which are not recorded in depfile.lock. gb vendor does not fetch remote
+metadata, and only checks out repositories with file:// URLs.
+
+GB_MIRROR names a directory, or the http:// or https:// URL of a server,
+holding an archive of the content of depfile entries. Entries missing from
+$GB_HOME/cache are fetched from the mirror when it has them, and from
+their upstream repositories otherwise, unless offline. The content fetched
+from a mirror is verified against depfile.lock as usual.
+
+To populate a mirror, run
+
+	gb depfile download dir
+
+on a machine with network access, which fetches each entry in use by the
+project and writes an archive of each to dir. Mirrors written for several
+projects may share a directory.
 
 
 Plugin information
@@ -193,11 +661,32 @@ can be used to supply a project root.
 See http://getgb.io/docs/project for details
 
 
+Compile and run a program
+
+Usage:
+
+        gb run [build flags] <package | files.go> [--] [arguments...]
+
+Run compiles the named main package, or the main package formed by the
+named .go files, and runs the resulting program with the supplied arguments.
+
+The program is linked into the context's temporary working directory, not
+$PROJECT/bin, and is removed when gb exits. Standard input, output and
+error are connected to the program, signals received by gb are forwarded
+to it, and gb exits with the program's exit status.
+
+Arguments following the package are passed to the program. A -- may be
+used to separate the package from arguments which look like .go files.
+
+The build flags are shared by the build and test commands. For more
+information, run 'gb help build'.
+
+
 Test packages
 
 Usage:
 
-        gb test [build flags] -n -v [packages] [flags for test binary]
+        gb test [build flags] -n -v -vet [packages] [flags for test binary]
 
 Test automates testing the packages named by the import paths.
 
@@ -210,6 +699,61 @@ Flags:
                 print output from test subprocess.
 	-n
 		do not execute test binaries, compile only
+	-vet
+		vet the packages before testing them, see 'gb help vet'. Tests
+		are not run if vet reports any problems.
+
+
+Report likely mistakes in packages
+
+Usage:
+
+        gb vet [build flags] [packages]
+
+Vet type checks the packages named by the import paths, along with their
+tests, and reports suspicious constructs, such as Printf calls whose
+arguments do not align with the format string.
+
+Packages are loaded in the same way as 'gb build', so imports are resolved
+from $PROJECT/src, $PROJECT/vendor/src, the depfile cache and $GOROOT.
+Problems are reported relative to the project root, and vet exits with a
+non zero status if any are found.
+
+The checks performed are:
+
+	assign        useless assignments, x = x
+	atomic        x = atomic.AddInt64(&x, 1)
+	composites    unkeyed composite literals of imported struct types
+	copylocks     locks, such as sync.Mutex, passed or copied by value
+	nilfunc       comparisons between functions and nil
+	printf        Printf format strings which do not match their arguments
+	structtag     malformed struct field tags and duplicate json or xml names
+	unreachable   unreachable code
+	unusedresult  unused results of calls to functions such as fmt.Sprintf
+
+The build flags are shared by the build and test commands. For more
+information, run 'gb help build'.
+
+See also: gb test -vet.
+
+
+Explain why a package is in the build
+
+Usage:
+
+        gb why importpath [packages]
+
+Why prints the shortest import chain from each of the packages named by the
+import paths to the package importpath, one package per line, followed by a
+blank line. If no packages are named, all packages in $PROJECT/src are used.
+
+A chain is not printed if it passes through another named package, as
+that package's own chain already explains it.
+
+If a package only depends on importpath through the imports of its tests,
+the chain starts with the package followed by "(test)".
+
+Why exits with a non zero status if none of the packages import importpath.
 
 
 */
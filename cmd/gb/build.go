@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"go/build"
 	"os"
 	"path/filepath"
@@ -39,6 +40,15 @@ var (
 	dotfile string // path to dot output file
 
 	buildtags []string
+
+	cacheURL string // url of the remote build cache
+
+	allowInternal bool // do not enforce the visibility of internal packages
+	strict        bool // fail if an import is provided by more than one root
+	useGopath     bool // fall back to $GOPATH for packages not in the project
+
+	output  string // -o destination for binaries
+	binname string // template for binary names
 )
 
 func addBuildFlags(fs *flag.FlagSet) {
@@ -52,12 +62,16 @@ func addBuildFlags(fs *flag.FlagSet) {
 	fs.Var((*stringsFlag)(&gcflags), "gcflags", "flags passed to the compiler")
 	fs.StringVar(&dotfile, "dotfile", "", "path to dot output file")
 	fs.Var((*stringsFlag)(&buildtags), "tags", "")
+	fs.StringVar(&cacheURL, "cache", os.Getenv("GB_CACHE"), "url of remote build cache")
+	fs.BoolVar(&allowInternal, "allowinternal", false, "do not enforce the visibility of internal packages")
+	fs.BoolVar(&strict, "strict", false, "fail if an import is provided by more than one root")
+	fs.BoolVar(&useGopath, "gopath", false, "fall back to $GOPATH for packages not in the project")
 }
 
 var buildCmd = &cmd.Command{
 	Name:      "build",
 	Short:     "build a package",
-	UsageLine: "build [build flags] [packages]",
+	UsageLine: "build [build flags] [-o output] [-name template] [packages]",
 	Long: `
 Build compiles the packages named by the import paths, along with their
 dependencies.
@@ -91,6 +105,37 @@ Flags:
                 Supported only on linux/amd64, freebsd/amd64, darwin/amd64 and windows/amd64.
 	-tags 'tag list'
 		additional build tags.
+	-cache url
+		fetch compiled packages from, and store compiled packages in, the
+		remote build cache at url. Defaults to the value of $GB_CACHE.
+		See 'gb help cache-server'.
+	-allowinternal
+		allow packages inside an internal directory to be imported by
+		packages outside the tree rooted at the parent of that directory.
+		By default gb, like the go tool, rejects such imports.
+	-strict
+		fail if an import path is provided by more than one of GOROOT,
+		$PROJECT/src, $PROJECT/vendor/src, $GOPATH if enabled, the depfile
+		cache, required modules and depfile overrides, as only one of them
+		is used. See 'gb list -shadowed'.
+	-gopath
+		resolve packages not found in $PROJECT/src or $PROJECT/vendor/src
+		from each $GOPATH entry, in order, before the depfile cache. Packages
+		resolved from $GOPATH are listed in a warning, as they are not part
+		of the project. This can also be enabled for the project with the
+		depfile option 'gopath enabled=true'.
+	-o file
+		write the binary for the single main package being built to file.
+	-o dir/
+		write binaries to dir, rather than $PROJECT/bin. dir is treated as
+		a directory if it ends in a path separator or already exists.
+	-name 'template'
+		name binaries using the text/template, for example
+		'{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}'. The fields available are
+		.Name, the default name of the binary, .ImportPath, .GOOS, .GOARCH,
+		.Tags, the build tags joined with "-", and .Ext, which is ".exe" when
+		targeting windows. When a template is supplied, no suffix is added
+		to the name of the binary.
 
 The list flags accept a space-separated list of strings. To embed spaces in an
 element in the list, surround it with either single or double quotes.
@@ -106,6 +151,21 @@ For more about where packages and binaries are installed, run 'gb help project'.
 		if err != nil {
 			return err
 		}
+		if err := warnGopath(ctx, pkgs); err != nil {
+			return err
+		}
+
+		if ctx.OutputFile() != "" {
+			var mains int
+			for _, pkg := range pkgs {
+				if pkg.Main {
+					mains++
+				}
+			}
+			if mains != 1 {
+				return errors.Errorf("-o %s requires a single main package, found %d; use -o dir/ to build many", output, mains)
+			}
+		}
 
 		build, err := gb.BuildPackages(pkgs...)
 		if err != nil {
@@ -124,7 +184,34 @@ For more about where packages and binaries are installed, run 'gb help project'.
 		startSigHandlers()
 		return gb.ExecuteConcurrent(build, P, interrupted)
 	},
-	AddFlags: addBuildFlags,
+	AddFlags: func(fs *flag.FlagSet) {
+		addBuildFlags(fs)
+		fs.StringVar(&output, "o", "", "output file or directory for binaries")
+		fs.StringVar(&binname, "name", "", "template for binary names")
+	},
+}
+
+// warnGopath prints a summary of the packages imported by pkgs, directly or
+// indirectly, which were resolved from $GOPATH.
+func warnGopath(ctx *gb.Context, pkgs []*gb.Package) error {
+	deps, err := transitiveDeps(ctx, pkgs, false)
+	if err != nil {
+		return err
+	}
+	var gopath []*gb.Package
+	for _, pkg := range deps {
+		if pkg.Origin() == "gopath" {
+			gopath = append(gopath, pkg)
+		}
+	}
+	if len(gopath) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "warning: %d package(s) resolved from $GOPATH:\n", len(gopath))
+	for _, pkg := range gopath {
+		fmt.Fprintf(os.Stderr, "\t%s\t%s\n", pkg.ImportPath, pkg.Dir)
+	}
+	return nil
 }
 
 // Resolver resolves packages.
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/internal/fileutils"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "cache",
+		UsageLine: "cache list | verify | prune [-unused-since age] | clean",
+		Short:     "manage the depfile download cache",
+		Long: `
+Cache manages $GB_HOME/cache, where the packages named in the depfiles of
+all projects are downloaded. Each directory of the cache holds one release,
+tag, archive or checkout of a package, and is recorded in the index
+$GB_HOME/cache/index when it is fetched, along with the sha256 of its
+content. The index also records when each directory was last used by gb.
+
+The subcommands are:
+
+	list
+		print the import path, source, size and date of last use of each
+		directory in the cache.
+	verify
+		hash the content of each directory in the cache again, and report
+		those which no longer match the sha256 recorded when they were
+		fetched.
+	prune [-unused-since age]
+		remove the directories which have not been used for age, 30d by
+		default. Age is a number of days, such as 30d, or a duration
+		such as 12h.
+	clean
+		remove the entire cache.
+
+Cache does not read the depfile of the project, so it neither fetches its
+entries nor records their use.
+
+Directories fetched by versions of gb which did not maintain the index are
+listed without an import path, are not verified, and are pruned by the time
+they were last modified.
+`,
+		Run: cacheCmd,
+		FlagParse: func(fs *flag.FlagSet, args []string) error {
+			if err := fs.Parse(args[2:]); err != nil {
+				return err
+			}
+			// the cache is managed without reading the depfile, so
+			// nothing is fetched, or marked as used, by the command.
+			skipDepfile = true
+			return nil
+		},
+		SkipParseArgs: true,
+	})
+}
+
+func cacheCmd(ctx *gb.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("no subcommand supplied")
+	}
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			return errors.New("list takes no arguments")
+		}
+		return listCache()
+	case "verify":
+		if len(args) > 1 {
+			return errors.New("verify takes no arguments")
+		}
+		return verifyCache()
+	case "prune":
+		fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+		unusedSince := fs.String("unused-since", "30d", "remove entries unused for this long")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return errors.New("prune takes no arguments")
+		}
+		age, err := parseAge(*unusedSince)
+		if err != nil {
+			return err
+		}
+		return pruneCache(time.Now().Add(-age))
+	case "clean":
+		if len(args) > 1 {
+			return errors.New("clean takes no arguments")
+		}
+		return fileutils.RemoveAll(gb.DepfileCache())
+	default:
+		return errors.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func listCache() error {
+	entries, err := gb.DepfileCacheEntries()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, e := range entries {
+		size, err := e.Size()
+		if err != nil {
+			return err
+		}
+		prefix, source := e.Prefix, e.Source
+		if prefix == "" {
+			prefix, source = e.Dir, "?"
+		}
+		used := "?"
+		if !e.Used.IsZero() {
+			used = e.Used.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", prefix, source, gb.FormatSize(size), used)
+	}
+	return w.Flush()
+}
+
+func verifyCache() error {
+	entries, err := gb.DepfileCacheEntries()
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, e := range entries {
+		if e.Prefix == "" {
+			continue
+		}
+		if err := e.Verify(); err != nil {
+			fmt.Println(err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d entries failed verification; remove them with gb cache clean, or by hand, to fetch them again", failed, len(entries))
+	}
+	return nil
+}
+
+// pruneCache removes the entries in the cache last used before t.
+func pruneCache(t time.Time) error {
+	entries, err := gb.DepfileCacheEntries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		used := e.Used
+		if used.IsZero() {
+			fi, err := os.Stat(e.Dir)
+			if err != nil {
+				return err
+			}
+			used = fi.ModTime()
+		}
+		if !used.Before(t) {
+			continue
+		}
+		size, err := e.Size()
+		if err != nil {
+			return err
+		}
+		name := e.Dir
+		if e.Prefix != "" {
+			name = e.Prefix + " (" + e.Source + ")"
+		}
+		switch err := e.Remove(); err {
+		case nil:
+		case gb.ErrEntryInUse:
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", name, err)
+			continue
+		default:
+			return err
+		}
+		fmt.Printf("removed %s, %s\n", name, gb.FormatSize(size))
+	}
+	return nil
+}
+
+// parseAge parses a number of days, such as 30d, or a duration.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.Errorf("invalid age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
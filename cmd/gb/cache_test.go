@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/constabulary/gb/internal/fileutils"
+)
+
+func TestCache(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "github.com/a/b"
+
+func main() {
+	println(b.B)
+}
+`)
+	gb.tempFile("depfile", `
+github.com/a/b	version=2.0.0
+`)
+	gbhome := gb.tempDir(".gb")
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=1`)
+	gb.tempFile(".gb/cache/0123456789abcdef0123456789abcdef01234567/src/github.com/c/d/d.go", `package d`)
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes(gb.path(".gb", "cache", "0123456789abcdef0123456789abcdef01234567"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	gb.setenv("GB_HOME", gbhome)
+
+	gb.cd(gb.tempdir)
+	gb.run("list") // indexes github.com/a/b
+
+	// the cache is managed without fetching the depfile.
+	gb.tempFile("depfile", `
+github.com/a/b	version=2.0.0
+example.invalid/x/y	url=https://example.invalid/y.tar.gz
+`)
+	gb.setenv("GB_OFFLINE", "1")
+	gb.run("cache", "list")
+	gb.grepStdout(`^github.com/a/b +2.0.0 +23 B +\d{4}-\d\d-\d\d \d\d:\d\d$`, "expected github.com/a/b in the cache")
+	gb.grepStdout(`0123456789abcdef0123456789abcdef01234567 +\? +10 B +\?$`, "expected unindexed entry in the cache")
+	gb.run("cache", "verify")
+
+	// an entry locked by another process is skipped.
+	unlock, err := fileutils.Lock(gb.path(".gb", "cache", "0123456789abcdef0123456789abcdef01234567.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb.run("cache", "prune")
+	gb.grepStderr(`^skipping .+0123456789abcdef0123456789abcdef01234567: in use by another gb process$`, "expected locked entry to be skipped")
+	gb.mustExist(gb.path(".gb", "cache", "0123456789abcdef0123456789abcdef01234567"))
+	unlock()
+
+	gb.run("cache", "prune")
+	gb.grepStdout(`^removed .+0123456789abcdef0123456789abcdef01234567, 10 B$`, "expected unused entry to be pruned")
+	gb.mustNotExist(gb.path(".gb", "cache", "0123456789abcdef0123456789abcdef01234567"))
+	gb.mustExist(gb.path(".gb", "cache", "f51babb8d8973d3796013755348c5a072f1a2e47"))
+
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=2`)
+	gb.runFail("cache", "verify")
+	gb.grepStdout(`^github.com/a/b \(2.0.0\): content has sha256 [0-9a-f]+, expected [0-9a-f]+$`, "expected github.com/a/b to fail verification")
+	gb.grepStderr(`1 of 1 entries failed verification`, "expected verification to fail")
+
+	gb.runFail("cache", "prune", "-unused-since", "soon")
+	gb.grepStderr(`invalid age "soon"`, "expected invalid age error")
+
+	gb.run("cache", "clean")
+	gb.mustNotExist(gb.path(".gb", "cache"))
+}
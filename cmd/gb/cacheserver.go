@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/internal/buildcache"
+	"github.com/pkg/errors"
+)
+
+var (
+	cacheServerAddr string // address to listen on
+	cacheServerDir  string // directory to store cache entries
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "cache-server",
+		UsageLine: "cache-server [-addr addr] -dir dir",
+		Short:     "run a remote build cache server",
+		Long: `
+Cache-server runs a reference implementation of the remote build cache.
+
+Compiled package archives and test results are stored under their action
+key, which is derived from the package's source, its dependencies, and the
+build flags. Entries are stored with a PUT request to $URL/$KEY and fetched
+with a GET request to the same location.
+
+To use the cache, pass its url to gb build or gb test with the -cache flag
+or set $GB_CACHE:
+
+	% gb cache-server -addr :8080 -dir /var/cache/gb
+	% GB_CACHE=http://localhost:8080 gb build
+
+Flags:
+
+	-addr
+		the address to listen on, defaults to localhost:8080.
+	-dir
+		the directory in which cache entries are stored.
+`,
+		Run:           cacheServer,
+		SkipParseArgs: true,
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&cacheServerAddr, "addr", "localhost:8080", "address to listen on")
+			fs.StringVar(&cacheServerDir, "dir", "", "directory to store cache entries")
+		},
+	})
+}
+
+func cacheServer(ctx *gb.Context, args []string) error {
+	if cacheServerDir == "" {
+		return errors.New("-dir is required")
+	}
+	if err := os.MkdirAll(cacheServerDir, 0755); err != nil {
+		return err
+	}
+	fmt.Printf("serving build cache %s on %s\n", cacheServerDir, cacheServerAddr)
+	return http.ListenAndServe(cacheServerAddr, &buildcache.Server{Dir: cacheServerDir})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"go/types"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/internal/typecheck"
+	"github.com/pkg/errors"
+)
+
+var (
+	checkOS      []string // target operating systems
+	checkArch    []string // target architectures
+	checkTagsets []string // sets of build tags, each comma separated
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "check",
+		UsageLine: "check [-os list] [-arch list] [-tagsets list] [-allowinternal] [-gopath] [packages]",
+		Short:     "type check packages for many platforms",
+		Long: `
+Check type checks the packages named by the import paths for each
+combination of target operating system, architecture and build tags,
+without compiling or linking them. For each combination the build
+constraints of every package, and its dependencies, are evaluated afresh,
+so files which are excluded on the host are checked too.
+
+Errors are reported with the platform they occur on, followed by a summary
+of the platforms each package fails on. Check exits with a non zero status
+if any package fails to type check.
+
+Flags:
+
+	-os 'list'
+		operating systems to check, for example 'linux darwin windows'.
+		Defaults to $GOOS, or the host operating system.
+	-arch 'list'
+		architectures to check, for example 'amd64 arm arm64'.
+		Defaults to $GOARCH, or the host architecture.
+	-tagsets 'list'
+		sets of build tags to check with, each set is comma separated,
+		for example 'netgo purego,noasm'. The -tags build flag is added
+		to each set. Defaults to the -tags build flag alone.
+	-allowinternal
+		do not enforce the visibility of internal packages.
+	-gopath
+		fall back to $GOPATH for packages not in the project.
+
+The list flags accept space or comma separated lists. Each platform is
+checked with the same depfile entries, modules and overrides as the
+project would be built with.
+`,
+		Run: check,
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.Var((*stringsFlag)(&checkOS), "os", "operating systems to check")
+			fs.Var((*stringsFlag)(&checkArch), "arch", "architectures to check")
+			fs.Var((*stringsFlag)(&checkTagsets), "tagsets", "sets of build tags to check")
+			fs.Var((*stringsFlag)(&buildtags), "tags", "")
+			fs.BoolVar(&allowInternal, "allowinternal", false, "do not enforce the visibility of internal packages")
+			fs.BoolVar(&useGopath, "gopath", false, "fall back to $GOPATH for packages not in the project")
+		},
+	})
+}
+
+// platform is a combination of target operating system, architecture, and
+// build tags.
+type platform struct {
+	goos, goarch string
+	tags         []string
+}
+
+func (p platform) String() string {
+	s := p.goos + "/" + p.goarch
+	if len(p.tags) > 0 {
+		s += " " + strings.Join(p.tags, ",")
+	}
+	return s
+}
+
+func check(ctx *gb.Context, args []string) error {
+	oses := splitList(checkOS)
+	if len(oses) == 0 {
+		oses = []string{envOr("GOOS", runtime.GOOS)}
+	}
+	arches := splitList(checkArch)
+	if len(arches) == 0 {
+		arches = []string{envOr("GOARCH", runtime.GOARCH)}
+	}
+	tagsets := [][]string{nil}
+	if len(checkTagsets) > 0 {
+		tagsets = nil
+		for _, set := range checkTagsets {
+			tagsets = append(tagsets, splitList([]string{set}))
+		}
+	}
+
+	failures := make(map[string][]platform) // import paths to the platforms they fail on
+	for _, goos := range oses {
+		for _, goarch := range arches {
+			for _, tags := range tagsets {
+				p := platform{goos: goos, goarch: goarch, tags: tags}
+				if err := checkPlatform(ctx, p, args, failures); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, path := range args {
+		if fails, ok := failures[path]; ok {
+			var s []string
+			for _, p := range fails {
+				s = append(s, p.String())
+			}
+			fmt.Printf("FAIL\t%s\t%s\n", path, strings.Join(s, "; "))
+			continue
+		}
+		fmt.Printf("ok\t%s\n", path)
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("%d package(s) failed to type check", len(failures))
+	}
+	return nil
+}
+
+// checkPlatform type checks the packages at paths for p, recording those
+// which fail in failures.
+func checkPlatform(ctx *gb.Context, p platform, paths []string, failures map[string][]platform) error {
+	pctx, err := newContext(
+		ctx.Projectdir(),
+		debug,
+		gb.GOOS(p.goos),
+		gb.GOARCH(p.goarch),
+		gb.Tags(p.tags...),
+	)
+	if err != nil {
+		return err
+	}
+	defer pctx.Destroy()
+
+	l := typecheck.NewLoader()
+	l.Sizes = types.SizesFor("gc", p.goarch)
+	for _, path := range paths {
+		pkg, err := pctx.ResolvePackage(path)
+		if _, nogo := errors.Cause(err).(*build.NoGoError); nogo {
+			// no files are built on this platform.
+			pctx.Debug("check: %s: %s: no buildable Go files", p, path)
+			continue
+		}
+		if err == nil {
+			_, _, err = l.Check(pkg, pkg.ImportPath, typecheck.GoFiles(pkg), nil)
+		}
+		if err == nil {
+			continue
+		}
+		failures[path] = append(failures[path], p)
+		errs, ok := err.(typecheck.Errors)
+		if !ok {
+			errs = typecheck.Errors{err}
+		}
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", p, relError(ctx.Projectdir(), err))
+		}
+	}
+	return nil
+}
+
+// relError returns the text of err, with the file name of a type error made
+// relative to root.
+func relError(root string, err error) string {
+	terr, ok := err.(types.Error)
+	if !ok {
+		return err.Error()
+	}
+	pos := terr.Fset.Position(terr.Pos)
+	if rel, err := filepath.Rel(root, pos.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+		pos.Filename = rel
+	}
+	return fmt.Sprintf("%s: %s", pos, terr.Msg)
+}
+
+// splitList splits each element of list on commas, discarding empty elements.
+func splitList(list []string) []string {
+	var s []string
+	for _, l := range list {
+		for _, e := range strings.Split(l, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				s = append(s, e)
+			}
+		}
+	}
+	return s
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,55 @@
+package main_test
+
+import "testing"
+
+func mkcheckfixture(gb *T) {
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"b\"\n\nvar X = b.Y + 1\n")
+	gb.tempFile("src/b/b_linux.go", "package b\n\nconst Y = 1\n")
+	gb.tempFile("src/b/b_other.go", "// +build !linux\n\npackage b\n\nconst Y = \"other\"\n")
+	gb.tempFile("src/c/c.go", "package c\n\nvar C int = D\n")
+	gb.tempFile("src/c/c_tag.go", "// +build special\n\npackage c\n\nconst D = \"special\"\n")
+	gb.tempFile("src/c/c_notag.go", "// +build !special\n\npackage c\n\nconst D = 1\n")
+}
+
+func TestCheck(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcheckfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("check", "-os", "linux,windows", "-arch", "amd64")
+	gb.grepStderr(`^windows/amd64: src/a/a.go:5:9: .*mismatched types`, "expected a to fail on windows")
+	gb.grepStderrNot(`^linux/amd64:`, "expected no errors on linux")
+	gb.grepStdout(`^FAIL\ta\twindows/amd64$`, "expected summary of a")
+	gb.grepStdout(`^ok\tb$`, "expected b to pass")
+	gb.grepStderr(`1 package\(s\) failed to type check`, "expected check failure")
+}
+
+func TestCheckTagsets(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcheckfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("check", "-os", "linux", "-arch", "amd64 arm", "-tagsets", "nothing special", "c")
+	gb.grepStdout(`^FAIL\tc\tlinux/amd64 special; linux/arm special$`, "expected c to fail with the special tag")
+}
+
+func TestCheckPasses(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcheckfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("check", "-os", "linux", "-arch", "amd64 arm64", "a", "b")
+	gb.grepStdout(`^ok\ta$`, "expected a to pass")
+}
+
+func TestCheckAllowInternal(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/internal/x/x.go", "package x\n\nconst X = 1\n")
+	gb.tempFile("src/b/b.go", "package b\n\nimport \"a/internal/x\"\n\nconst B = x.X\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("check", "-os", "linux", "-arch", "amd64", "b")
+	gb.grepStdout(`^FAIL\tb\tlinux/amd64$`, "expected b to fail without -allowinternal")
+	gb.run("check", "-os", "linux", "-arch", "amd64", "-allowinternal", "b")
+	gb.grepStdout(`^ok\tb$`, "expected b to pass with -allowinternal")
+}
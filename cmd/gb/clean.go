@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/internal/fileutils"
+)
+
+var (
+	cleanAll   bool // clean all contexts
+	cleanBin   bool // clean $PROJECT/bin
+	cleanStale bool // clean only archives without source
+	cleanCache bool // clean the depfile download cache
+	cleanNope  bool // print, but do not remove
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "clean",
+		UsageLine: "clean [-a] [-bin] [-stale] [-cache] [-n]",
+		Short:     "remove build outputs",
+		Long: `
+Clean removes build outputs from the project.
+
+By default clean removes the compiled packages for the current context,
+$PROJECT/pkg/$GOOS-$GOARCH[-tags], and any temporary files left in
+$PROJECT/bin by failed links.
+
+Flags:
+
+	-a
+		remove the compiled packages for all contexts, $PROJECT/pkg.
+	-bin
+		also remove compiled programs, $PROJECT/bin.
+	-stale
+		rather than removing the package cache for a context, remove only
+		those compiled packages which no longer correspond to a package in
+		$PROJECT/src, $PROJECT/vendor/src, $GOROOT/src, or the depfile
+		entries, modules and $GOPATH in use. Implies -a.
+	-cache
+		also remove the depfile download cache, $GB_HOME/cache.
+	-n
+		print the files and directories that would be removed, but do not
+		remove them.
+`,
+		Run:           clean,
+		SkipParseArgs: true,
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&cleanAll, "a", false, "clean all contexts")
+			fs.BoolVar(&cleanBin, "bin", false, "clean compiled programs")
+			fs.BoolVar(&cleanStale, "stale", false, "clean compiled packages without source")
+			fs.BoolVar(&cleanCache, "cache", false, "clean depfile download cache")
+			fs.BoolVar(&cleanNope, "n", false, "print, but do not remove")
+		},
+	})
+}
+
+func clean(ctx *gb.Context, args []string) error {
+	bindir := filepath.Join(ctx.Projectdir(), "bin")
+
+	var paths []string
+	switch {
+	case cleanStale:
+		stale, err := staleArchives(ctx)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, stale...)
+	case cleanAll:
+		paths = append(paths, ctx.Project.Pkgdir())
+	default:
+		paths = append(paths, ctx.Pkgdir())
+	}
+
+	if cleanBin {
+		paths = append(paths, bindir)
+	} else {
+		tmps, err := filepath.Glob(filepath.Join(bindir, ".gb-link*"))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, tmps...)
+	}
+
+	if cleanCache {
+		paths = append(paths, gb.DepfileCache())
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if cleanNope {
+			fmt.Printf("rm -r %s\n", path)
+			continue
+		}
+		ctx.Debug("removing %s", path)
+		if err := fileutils.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	if cleanStale && !cleanNope {
+		return removeEmptyDirs(ctx.Project.Pkgdir())
+	}
+	return nil
+}
+
+// staleArchives returns the compiled packages in any context of the project
+// whose import path is not provided by any of the source roots of ctx; the
+// project, its vendor directory, the standard library, and $GOPATH, the
+// depfile cache, modules and overrides in use.
+func staleArchives(ctx *gb.Context) ([]string, error) {
+	pkgdir := ctx.Project.Pkgdir()
+	dirs, err := ioutil.ReadDir(pkgdir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var stale []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		ctxdir := filepath.Join(pkgdir, dir.Name())
+		err := filepath.Walk(ctxdir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(path) != ".a" {
+				return nil
+			}
+			rel, err := filepath.Rel(ctxdir, path)
+			if err != nil {
+				return err
+			}
+			if len(ctx.Shadows(filepath.ToSlash(strings.TrimSuffix(rel, ".a")))) == 0 {
+				stale = append(stale, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// removeEmptyDirs removes any empty directories below root.
+func removeEmptyDirs(root string) error {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// remove the deepest directories first, so their parents may
+	// become empty in turn.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if fis, err := ioutil.ReadDir(dir); err == nil && len(fis) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main_test
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func mkcleanfixture(gb *T) {
+	ctx := runtime.GOOS + "-" + runtime.GOARCH
+	gb.tempFile("src/a/a.go", "package a\n")
+	gb.tempFile(filepath.Join("pkg", ctx, "a.a"), "!<arch>\n")
+	gb.tempFile(filepath.Join("pkg", ctx, "gone.a"), "!<arch>\n")
+	gb.tempFile(filepath.Join("pkg", ctx, "deleted", "b.a"), "!<arch>\n")
+	gb.tempFile(filepath.Join("pkg", "plan9-arm", "a.a"), "!<arch>\n")
+	gb.tempFile(filepath.Join("bin", "a"), "")
+	gb.tempFile(filepath.Join("bin", ".gb-link123456"), "")
+}
+
+func TestGbClean(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcleanfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("clean")
+	gb.mustNotExist(gb.path("pkg", runtime.GOOS+"-"+runtime.GOARCH))
+	gb.mustNotExist(gb.path("bin", ".gb-link123456"))
+	gb.mustExist(gb.path("pkg", "plan9-arm", "a.a"))
+	gb.mustExist(gb.path("bin", "a"))
+}
+
+func TestGbCleanAllBinaries(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcleanfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("clean", "-a", "-bin")
+	gb.mustNotExist(gb.path("pkg"))
+	gb.mustNotExist(gb.path("bin"))
+	gb.mustExist(gb.path("src", "a", "a.go"))
+}
+
+func TestGbCleanStale(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcleanfixture(&gb)
+	gb.cd(gb.tempdir)
+	ctx := runtime.GOOS + "-" + runtime.GOARCH
+	gb.run("clean", "-stale")
+	gb.mustExist(gb.path("pkg", ctx, "a.a"))
+	gb.mustExist(gb.path("pkg", "plan9-arm", "a.a"))
+	gb.mustNotExist(gb.path("pkg", ctx, "gone.a"))
+	gb.mustNotExist(gb.path("pkg", ctx, "deleted"))
+}
+
+func TestGbCleanStaleDepfile(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcleanfixture(&gb)
+	gb.tempFile("depfile", "github.com/a/b version=2.0.0\n")
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=1`)
+	gb.setenv("GB_HOME", gb.path(".gb"))
+	ctx := runtime.GOOS + "-" + runtime.GOARCH
+	gb.tempFile(filepath.Join("pkg", ctx, "github.com", "a", "b.a"), "!<arch>\n")
+	gb.tempFile(filepath.Join("pkg", ctx, "github.com", "a", "c.a"), "!<arch>\n")
+	gb.cd(gb.tempdir)
+	gb.run("clean", "-stale")
+	gb.mustExist(gb.path("pkg", ctx, "github.com", "a", "b.a"))
+	gb.mustNotExist(gb.path("pkg", ctx, "github.com", "a", "c.a"))
+}
+
+func TestGbCleanNope(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkcleanfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("clean", "-n", "-a")
+	gb.grepStdout(`^rm -r .*pkg$`, "expected pkg to be removed")
+	gb.mustExist(gb.path("pkg", runtime.GOOS+"-"+runtime.GOARCH, "a.a"))
+	gb.mustExist(gb.path("bin", ".gb-link123456"))
+}
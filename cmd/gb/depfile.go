@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/cmd/gb/internal/match"
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/pkg/errors"
+)
+
+var (
+	// relock is set when running gb depfile lock or update, which must be
+	// able to fetch depfile entries whose content no longer matches
+	// depfile.lock.
+	relock bool
+
+	// update is set when running gb depfile update, which resolves the
+	// version constraints of the entries in updatePrefixes, or all entries
+	// if empty.
+	update         bool
+	updatePrefixes []string
+
+	// skipDepfile is set when running commands which edit the depfile or
+	// depfile.local, which must not fetch its entries, or an entry which
+	// cannot be fetched could not be removed or overridden.
+	skipDepfile bool
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "depfile",
+		UsageLine: "depfile add | set | remove | list | why | lock | update | override | download [arguments]",
+		Short:     "manage the depfile",
+		Long: `
+Depfile manages $PROJECT/depfile, which names the packages gb downloads into
+$GB_HOME/cache, $PROJECT/depfile.lock and $PROJECT/depfile.local.
+
+The depfile.lock records the sha256 of the content of each entry in the
+depfile. When present, gb verifies the content of each entry, both when it
+is downloaded and on every build, so a release which is retagged upstream
+cannot silently change the build. An entry may also carry its own sha256
+key, which is verified in the same way. Once depfile.lock exists, every
+entry in use must be recorded in it; run gb depfile lock after adding one.
+Content which is not verified by depfile.lock, such as when it is written,
+is verified against the sha256 recorded when it was fetched into the cache,
+so content modified in the cache is never locked.
+
+The version of an entry may be a constraint rather than a single version,
+for example
+
+	github.com/pkg/errors version=^0.8.0
+	github.com/pkg/profile version=~1.2
+	github.com/pkg/sftp version=">=1.0.0 <2"
+
+Constraints are resolved to the highest release tagged vX.Y.Z upstream which
+satisfies them, and the release chosen is recorded in depfile.lock, so the
+build does not change until the entry is updated. Constraints are written
+^1.2.3 (>=1.2.3 <2.0.0), ~1.2.3 (>=1.2.3 <1.3.0), 1.2 or 1.2.x (>=1.2.0 <1.3.0),
+or with the comparisons >=, >, <=, < and =, separated by spaces or commas.
+
+A package fetched for the depfile may have a depfile of its own, at the top
+of its repository. Its entries are fetched in turn, and so on. When more
+than one depfile names the same package, and every entry names a version,
+an exact version such as 1.2.3 in $PROJECT/depfile is always used.
+Otherwise the highest version required is used; in the depfile of a
+dependency an exact version is a minimum, satisfied by any later compatible
+release, as if written ^1.2.3. Every entry must be satisfied by the version
+used, so a dependency which requires a later release than the project pins
+is reported as a conflict; write the project's entry as a constraint, such
+as ^1.2.3, to accept it.
+Entries which name a tag, archive URL or repository must all name the same
+content. Otherwise gb reports each conflicting entry, and the depfile which
+contains it, and stops.
+
+Some names are reserved for options of the project, rather than naming a
+package. The option
+
+	gopath enabled=true
+
+resolves packages not found in the project from $GOPATH, as gb build -gopath
+does. Options are set with gb depfile add and set like entries, but are not
+listed by gb depfile list, and are ignored in the depfiles of fetched
+packages.
+
+An entry with a path key, for example
+
+	github.com/pkg/errors version=0.8.0 path=../errors
+
+uses the package in the local directory, relative to $PROJECT, rather than
+downloading it, so a change to a dependency can be tried without publishing
+a release. Entries in $PROJECT/depfile.local, which is written by
+gb depfile override and is not meant to be committed, override the depfile
+in the same way. The depfile of an overridden package is still read, and an
+override is used in place of every entry naming its prefix. Overridden
+packages have the origin "override" in gb list, and are listed by gb info
+as GB_DEPFILE_OVERRIDES.
+
+Missing entries are fetched when the depfile is read, several at once; as
+many as the -P flag allows for commands which accept it. Each download is
+reported with its size, and requests which fail with a transient network or
+server error, including a connection lost during the download, are retried,
+with increasing delays; unknown hosts and other permanent errors are not.
+gb processes sharing $GB_HOME, such as parallel CI jobs, take a lock on each
+entry in the cache while fetching it, so an entry is fetched once and never
+read while it is incomplete. Entries may also be fetched from a local mirror, or
+never fetched at all; see gb help offline.
+
+The subcommands are:
+
+	add prefix key=value...
+		add an entry for prefix to the depfile.
+	set prefix key=value...
+		set keys of the entry for prefix; key= removes the key.
+	remove prefix...
+		remove the entries for the prefixes from the depfile.
+	list
+		print each entry in the depfile, followed by the packages in
+		the project which import a package it provides.
+	why prefix
+		print the shortest import chain from each package in the
+		project to a package provided by the entry for prefix.
+	lock
+		fetch each entry in the depfile and write depfile.lock,
+		replacing the hashes of any entries which have changed.
+	update [prefixes]
+		resolve the version constraints of the named entries, or all
+		entries, to the highest matching release, and write
+		depfile.lock.
+	override [prefix=dir | prefix]...
+		in $PROJECT/depfile.local, replace the content of prefix with
+		the directory dir, or remove the override of prefix. With no
+		arguments, print the overrides in use.
+	download dir
+		fetch each entry in use and write an archive of each to dir,
+		for use as GB_MIRROR; see gb help offline.
+
+Add and set check the entry before writing it: the version or tag of an
+entry downloaded from a forge must be tagged upstream, and a version
+constraint must match at least one release. The depfile is rewritten with
+its comments, blank lines and the order of its entries preserved. Add, set,
+remove and override do not fetch the entries of the depfile, so an entry
+which can no longer be fetched can still be changed, removed or overridden.
+
+List marks entries which are only imported by other dependencies as
+"(indirect)", and entries which nothing in the project imports as
+"(unused)".
+`,
+		Run: depfileCmd,
+		FlagParse: func(fs *flag.FlagSet, args []string) error {
+			if err := fs.Parse(args[2:]); err != nil {
+				return err
+			}
+			if args := fs.Args(); len(args) > 0 {
+				switch args[0] {
+				case "lock":
+					relock = true
+				case "add", "set", "remove":
+					skipDepfile = true
+				case "override":
+					// an override replaces an entry which cannot be
+					// fetched, but listing the overrides in use reads
+					// the depfile.
+					skipDepfile = len(args) > 1
+				case "update":
+					relock, update, updatePrefixes = true, true, args[1:]
+				}
+			}
+			return nil
+		},
+		SkipParseArgs: true,
+	})
+}
+
+func depfileCmd(ctx *gb.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("no subcommand supplied")
+	}
+	switch args[0] {
+	case "lock":
+		if len(args) > 1 {
+			return errors.New("lock takes no arguments")
+		}
+		return errors.Wrap(ctx.WriteDepfileLock(), "could not write depfile.lock")
+	case "update":
+		// the entries were resolved again when the context was created.
+		return errors.Wrap(ctx.WriteDepfileLock(), "could not write depfile.lock")
+	case "add":
+		if len(args) < 3 {
+			return errors.New("usage: gb depfile add prefix key=value...")
+		}
+		return editDepfile(ctx, func(f *depfile.File) error {
+			prefix := args[1]
+			if f.Entry(prefix) != nil {
+				return errors.Errorf("%s is already in the depfile; use gb depfile set", prefix)
+			}
+			kv, err := parseKeyVals(args[2:])
+			if err != nil {
+				return err
+			}
+			for k, v := range kv {
+				if v == "" {
+					return errors.Errorf("%s: key %q has no value", prefix, k)
+				}
+			}
+			if err := checkEntry(prefix, kv); err != nil {
+				return err
+			}
+			f.Set(prefix, kv)
+			return nil
+		})
+	case "set":
+		if len(args) < 3 {
+			return errors.New("usage: gb depfile set prefix key=value...")
+		}
+		return editDepfile(ctx, func(f *depfile.File) error {
+			prefix := args[1]
+			entry := f.Entry(prefix)
+			if entry == nil {
+				return errors.Errorf("%s is not in the depfile; use gb depfile add", prefix)
+			}
+			kv, err := parseKeyVals(args[2:])
+			if err != nil {
+				return err
+			}
+			for k, v := range kv {
+				if v == "" {
+					delete(entry, k)
+					continue
+				}
+				entry[k] = v
+			}
+			if len(entry) == 0 {
+				return errors.Errorf("%s: no keys left; use gb depfile remove", prefix)
+			}
+			if err := checkEntry(prefix, entry); err != nil {
+				return err
+			}
+			f.Set(prefix, kv)
+			return nil
+		})
+	case "remove":
+		if len(args) < 2 {
+			return errors.New("usage: gb depfile remove prefix...")
+		}
+		return editDepfile(ctx, func(f *depfile.File) error {
+			for _, prefix := range args[1:] {
+				if !f.Remove(prefix) {
+					return errors.Errorf("%s is not in the depfile", prefix)
+				}
+			}
+			return nil
+		})
+	case "list":
+		if len(args) > 1 {
+			return errors.New("list takes no arguments")
+		}
+		return listDepfile(ctx)
+	case "why":
+		if len(args) != 2 {
+			return errors.New("usage: gb depfile why prefix")
+		}
+		return whyDepfile(ctx, args[1])
+	case "download":
+		if len(args) != 2 {
+			return errors.New("usage: gb depfile download dir")
+		}
+		// the entries were fetched when the context was created.
+		return errors.Wrap(ctx.WriteDepfileMirror(args[1]), "could not write mirror")
+	case "override":
+		if len(args) == 1 {
+			for _, o := range overrides(ctx) {
+				fmt.Println(o)
+			}
+			return nil
+		}
+		return writeOverrides(ctx, args[1:])
+	default:
+		return errors.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+// writeOverrides updates $PROJECT/depfile.local with the overrides in args,
+// each prefix=dir to override prefix, or prefix to remove its override.
+func writeOverrides(ctx *gb.Context, args []string) error {
+	file := filepath.Join(ctx.Projectdir(), "depfile.local")
+	local, err := depfile.ParseFile(file)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		local = make(map[string]map[string]string)
+	case err != nil:
+		return errors.Wrap(err, "could not parse depfile.local")
+	}
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			delete(local, arg)
+			continue
+		}
+		prefix, dir := arg[:i], arg[i+1:]
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return errors.Errorf("%s: %s is not a directory", prefix, dir)
+		}
+		local[prefix] = map[string]string{"path": dir}
+	}
+	if len(local) == 0 {
+		err := os.Remove(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var prefixes []string
+	for prefix := range local {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# local depfile overrides, written by gb depfile override; do not commit.")
+	for _, prefix := range prefixes {
+		fmt.Fprintln(&buf, depfile.FormatLine(prefix, local[prefix]))
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// editDepfile reads $PROJECT/depfile, or starts a new one if there is none,
+// applies edit, and writes it back.
+func editDepfile(ctx *gb.Context, edit func(*depfile.File) error) error {
+	file := filepath.Join(ctx.Projectdir(), "depfile")
+	f, err := depfile.ReadFile(file)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		f = new(depfile.File)
+	case err != nil:
+		return errors.Wrap(err, "could not parse depfile")
+	}
+	if err := edit(f); err != nil {
+		return err
+	}
+	return f.WriteFile(file)
+}
+
+// parseKeyVals parses arguments of the form key=value.
+func parseKeyVals(args []string) (map[string]string, error) {
+	kv := make(map[string]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("expected key=value, got %q", arg)
+		}
+		kv[parts[0]] = parts[1]
+	}
+	return kv, nil
+}
+
+// checkEntry returns an error if kv is not a valid depfile entry, or
+// setting of a project option, for prefix.
+func checkEntry(prefix string, kv map[string]string) error {
+	if depfile.IsOption(prefix) {
+		return gb.CheckDepfileOption(prefix, kv)
+	}
+	return gb.CheckDepfileEntry(prefix, kv)
+}
+
+// listDepfile prints each entry in $PROJECT/depfile, followed by the
+// packages in the project which import a package it provides.
+func listDepfile(ctx *gb.Context) error {
+	f, err := depfile.ReadFile(filepath.Join(ctx.Projectdir(), "depfile"))
+	if err != nil {
+		return errors.Wrap(err, "could not parse depfile")
+	}
+	roots, err := projectPackages(ctx)
+	if err != nil {
+		return err
+	}
+	deps, err := transitiveDeps(ctx, roots, true)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range f.Names() {
+		var users []string
+		for _, root := range roots {
+			if importsPrefix(root.Imports, prefix) {
+				users = append(users, root.ImportPath)
+				continue
+			}
+			imports, err := testImports(ctx, root)
+			if err != nil {
+				return err
+			}
+			if importsPrefix(imports, prefix) {
+				users = append(users, root.ImportPath+" (test)")
+			}
+		}
+		line := depfile.FormatLine(prefix, f.Entry(prefix))
+		switch {
+		case len(users) > 0:
+		case importsPrefix(deps, prefix):
+			line += " (indirect)"
+		default:
+			line += " (unused)"
+		}
+		fmt.Println(line)
+		for _, user := range users {
+			fmt.Printf("\t%s\n", user)
+		}
+	}
+	return nil
+}
+
+// whyDepfile prints the shortest import chain from each package in the
+// project to a package provided by prefix.
+func whyDepfile(ctx *gb.Context, prefix string) error {
+	if depfile.IsOption(prefix) {
+		return errors.Errorf("%s is a project option, not a package", prefix)
+	}
+	roots, err := projectPackages(ctx)
+	if err != nil {
+		return err
+	}
+	chains := whyChains(ctx, func(pkg *gb.Package) bool {
+		return providedBy(pkg.ImportPath, prefix)
+	}, roots)
+	if len(chains) == 0 {
+		return errors.Errorf("%s is not used by the project", prefix)
+	}
+	printChains(chains)
+	return nil
+}
+
+// projectPackages resolves all the packages in $PROJECT/src.
+func projectPackages(ctx *gb.Context) ([]*gb.Package, error) {
+	srcdir := filepath.Join(ctx.Projectdir(), "src")
+	return resolveRootPackages(ctx, match.ImportPaths(srcdir, srcdir, []string{"..."})...)
+}
+
+// importsPrefix reports whether any of pkgs is provided by prefix.
+func importsPrefix(pkgs []*gb.Package, prefix string) bool {
+	for _, pkg := range pkgs {
+		if providedBy(pkg.ImportPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// providedBy reports whether the package at path belongs to the depfile
+// entry prefix.
+func providedBy(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -1,7 +1,9 @@
 package main_test
 
 import (
+	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"testing"
 )
@@ -108,7 +110,7 @@ github.com/a/b	tag=2.0.0
 `)
 
 	gbhome := gb.tempDir(".gb")
-	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=1`)
+	gb.tempFile(".gb/cache/0e594c9ac67eaa60d56a36da89914a9ffeb0dcb8/src/github.com/a/b/b.go", `package b; const B=1`)
 	gb.setenv("GB_HOME", gbhome)
 
 	gb.cd(gb.tempdir)
@@ -153,3 +155,222 @@ github.com/pkg/profile	tag=v1.1.0
 	gb.grepStdout("^fetching github.com/pkg/profile", "fetching pkg/profile not found")
 	gb.mustExist(filepath.Join(gbhome, "cache", "e693c641ace92b5910c4a64d3241128094f74f19", "src", "github.com", "pkg", "profile", "profile.go"))
 }
+
+func TestDepfileLock(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempDir("src/github.com/user/proj/a/")
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "github.com/a/b"
+
+func main() {
+	println(b.B)
+}
+`)
+	gb.tempFile("depfile", `
+github.com/a/b	version=2.0.0
+`)
+
+	gbhome := gb.tempDir(".gb")
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=1`)
+	gb.setenv("GB_HOME", gbhome)
+
+	gb.cd(gb.tempdir)
+	gb.run("depfile", "lock")
+	gb.mustExist(gb.path("depfile.lock"))
+	gb.run("list")
+
+	// modify the cached copy of github.com/a/b.
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=2`)
+	gb.runFail("list")
+	gb.grepStderr(`github.com/a/b: cached content in .+ has sha256 [0-9a-f]+, expected [0-9a-f]+`, "expected cached content mismatch")
+
+	// the modified copy is not locked.
+	gb.runFail("depfile", "lock")
+	gb.grepStderr(`github.com/a/b: cached content in .+ has sha256 [0-9a-f]+, but had [0-9a-f]+ when fetched`, "expected modified content error")
+
+	// an entry missing from the lock is not trusted.
+	gb.tempFile(".gb/cache/f51babb8d8973d3796013755348c5a072f1a2e47/src/github.com/a/b/b.go", `package b; const B=1`)
+	gb.tempFile("depfile.lock", "# generated by gb depfile lock; do not edit.\n")
+	gb.runFail("list")
+	gb.grepStderr(`no entry for github.com/a/b in depfile.lock; run gb depfile lock`, "expected missing lock entry error")
+	gb.run("depfile", "lock")
+	gb.run("list")
+}
+
+func TestDepfileOverride(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "github.com/a/b"
+
+func main() {
+	println(b.B)
+}
+`)
+	gb.tempFile("mylib/b.go", `package b; const B=1`)
+
+	gb.cd(gb.tempdir)
+	gb.runFail("list", "-f", "{{.ImportPath}} {{.Origin}}", "-deps", "github.com/user/proj/a")
+	gb.run("depfile", "override", "github.com/a/b="+gb.path("mylib"))
+	gb.mustExist(gb.path("depfile.local"))
+
+	gb.run("depfile", "override")
+	gb.grepStdout(`^github.com/a/b=`+regexp.QuoteMeta(gb.path("mylib"))+`$`, "expected override of github.com/a/b")
+	gb.run("info", "GB_DEPFILE_OVERRIDES")
+	gb.grepStdout(`^github.com/a/b=`+regexp.QuoteMeta(gb.path("mylib"))+`$`, "expected GB_DEPFILE_OVERRIDES")
+	gb.run("list", "-f", "{{.ImportPath}} {{.Origin}}", "-deps", "github.com/user/proj/a")
+	gb.grepStdout(`^github.com/a/b override$`, "expected github.com/a/b from the override")
+
+	gb.run("depfile", "override", "github.com/a/b")
+	gb.mustNotExist(gb.path("depfile.local"))
+	gb.runFail("list", "-f", "{{.ImportPath}} {{.Origin}}", "-deps", "github.com/user/proj/a")
+}
+
+func TestDepfileOverrideUnfetchable(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "example.invalid/x/y"
+
+func main() {
+	println(y.Y)
+}
+`)
+	gb.tempFile("mylib/y.go", `package y; const Y=1`)
+	gb.tempFile("depfile", `example.invalid/x/y url=https://example.invalid/y.tar.gz
+`)
+	gb.setenv("GB_HOME", gb.tempDir(".gb"))
+	gb.setenv("GB_OFFLINE", "1")
+
+	gb.cd(gb.tempdir)
+	gb.runFail("list", "github.com/user/proj/a")
+	gb.grepStderr(`network access is disabled by GB_OFFLINE`, "expected offline error")
+	gb.run("depfile", "override", "example.invalid/x/y="+gb.path("mylib"))
+	gb.run("list", "-f", "{{.ImportPath}} {{.Origin}}", "-deps", "github.com/user/proj/a")
+	gb.grepStdout(`^example.invalid/x/y override$`, "expected example.invalid/x/y from the override")
+	gb.run("depfile", "override", "example.invalid/x/y")
+	gb.mustNotExist(gb.path("depfile.local"))
+}
+
+func TestDepfileEdit(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "github.com/a/b"
+
+func main() {
+	println(b.B)
+}
+`)
+	gb.tempFile("mylib/b.go", `package b
+
+import "github.com/c/d"
+
+const B = d.D
+`)
+	gb.tempFile("other/d.go", `package d; const D=1`)
+	gb.tempFile("unused/e.go", `package e`)
+	gb.tempFile("depfile", `# dependencies of proj
+
+github.com/a/b path=mylib
+`)
+
+	gb.cd(gb.tempdir)
+	gb.run("depfile", "add", "github.com/c/d", "path=other")
+	gb.runFail("depfile", "add", "github.com/c/d", "path=other")
+	gb.grepStderr(`github.com/c/d is already in the depfile`, "expected duplicate entry error")
+	gb.run("depfile", "add", "github.com/e/f", "path=unused")
+	gb.runFail("depfile", "set", "github.com/e/f", "path=")
+	gb.grepStderr(`github.com/e/f: no keys left`, "expected no keys left error")
+	gb.runFail("depfile", "add", "github.com/g/h", "commit=abc")
+	gb.grepStderr(`github.com/g/h: expected a version, tag, url, vcs, path or module key`, "expected invalid entry error")
+
+	gb.run("depfile", "list")
+	gb.grepStdout(`^github.com/a/b path=mylib$`, "expected github.com/a/b")
+	gb.grepStdout(`^\tgithub.com/user/proj/a$`, "expected github.com/user/proj/a to use github.com/a/b")
+	gb.grepStdout(`^github.com/c/d path=other \(indirect\)$`, "expected github.com/c/d to be indirect")
+	gb.grepStdout(`^github.com/e/f path=unused \(unused\)$`, "expected github.com/e/f to be unused")
+
+	gb.run("depfile", "why", "github.com/c/d")
+	gb.grepStdout(`^github.com/a/b$`, "expected chain through github.com/a/b")
+	gb.runFail("depfile", "why", "github.com/e/f")
+	gb.grepStderr(`github.com/e/f is not used by the project`, "expected github.com/e/f to be unused")
+
+	gb.run("depfile", "remove", "github.com/e/f")
+	gb.runFail("depfile", "remove", "github.com/e/f")
+	want := `# dependencies of proj
+
+github.com/a/b path=mylib
+github.com/c/d path=other
+`
+	got, err := ioutil.ReadFile(gb.path("depfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("depfile: got %q, want %q", got, want)
+	}
+}
+
+func TestDepfileEditUnfetchable(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+func main() {}
+`)
+	gb.tempFile("fixed/y.go", `package y`)
+	gb.tempFile("depfile", `example.invalid/x/y url=https://example.invalid/y.tar.gz
+example.invalid/x/z url=https://example.invalid/z.tar.gz
+`)
+	gb.setenv("GB_HOME", gb.tempDir(".gb"))
+	gb.setenv("GB_OFFLINE", "1")
+
+	gb.cd(gb.tempdir)
+	gb.runFail("list")
+	gb.grepStderr(`network access is disabled by GB_OFFLINE`, "expected offline error")
+	gb.run("depfile", "set", "example.invalid/x/y", "url=", "path=fixed")
+	gb.run("depfile", "remove", "example.invalid/x/z")
+	want := "example.invalid/x/y path=fixed\n"
+	got, err := ioutil.ReadFile(gb.path("depfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("depfile: got %q, want %q", got, want)
+	}
+	gb.run("list")
+}
+
+func TestDepfileOffline(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+
+	gb.tempFile("src/github.com/user/proj/a/main.go", `package main
+
+import "github.com/a/b"
+
+func main() {
+	println(b.B)
+}
+`)
+	gb.tempFile("depfile", `
+github.com/a/b version=2.0.3
+`)
+	gbhome := gb.tempDir(".gb")
+	gb.setenv("GB_HOME", gbhome)
+
+	gb.cd(gb.tempdir)
+	gb.runFail("list", "-offline")
+	gb.grepStderr(`github.com/a/b \(2.0.3\) is not in .+ or GB_MIRROR, and network access is disabled by GB_OFFLINE`, "expected network access disabled error")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	gofmt "go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/pkg/errors"
+)
+
+var (
+	fmtCheck   bool // list unformatted files, do not write them
+	fmtImports bool // group imports by origin
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "fmt",
+		UsageLine: "fmt [-check] [-imports] [packages]",
+		Short:     "format package sources",
+		Long: `
+Fmt reformats the Go source files of the packages named by the import paths
+with the standard Go formatter, and prints the names of the files modified.
+
+Only packages in $PROJECT/src are formatted; $PROJECT/vendor/src is never
+modified. Files excluded by build constraints are formatted too.
+
+Flags:
+
+	-check
+		list the files which are not formatted, but do not modify them.
+		fmt exits with a non zero status if any files are listed.
+	-imports
+		also group each file's imports into blocks of standard library,
+		third party (vendored or depfile), and project packages, in that
+		order, sorting each block. Imports are classified using the same
+		resolver as 'gb build'. Import declarations containing comments
+		are left as they are.
+`,
+		Run: fmtPackages,
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&fmtCheck, "check", false, "list unformatted files, do not write them")
+			fs.BoolVar(&fmtImports, "imports", false, "group imports by origin")
+		},
+	})
+}
+
+func fmtPackages(ctx *gb.Context, args []string) error {
+	srcdir := filepath.Join(ctx.Projectdir(), "src")
+	var unformatted []string
+	for _, path := range args {
+		dir := filepath.Join(srcdir, filepath.FromSlash(path))
+		files, err := goSourceFiles(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			changed, err := fmtFile(ctx, file)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			rel, err := filepath.Rel(ctx.Projectdir(), file)
+			if err != nil {
+				return err
+			}
+			fmt.Println(rel)
+			unformatted = append(unformatted, rel)
+		}
+	}
+	if fmtCheck && len(unformatted) > 0 {
+		return errors.Errorf("%d file(s) not formatted", len(unformatted))
+	}
+	return nil
+}
+
+// goSourceFiles returns the .go files in dir, regardless of build constraints.
+func goSourceFiles(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+// fmtFile formats file, writing the result unless -check was supplied, and
+// reports whether the formatted source differs from the original.
+func fmtFile(ctx *gb.Context, file string) (bool, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	out := src
+	if fmtImports {
+		out, err = groupImports(file, out, importClassifier(ctx))
+		if err != nil {
+			return false, err
+		}
+	}
+	out, err = gofmt.Source(out)
+	if err != nil {
+		return false, errors.Wrapf(err, "format %s", file)
+	}
+	if bytes.Equal(src, out) {
+		return false, nil
+	}
+	if fmtCheck {
+		return true, nil
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return false, err
+	}
+	return true, ioutil.WriteFile(file, out, fi.Mode())
+}
+
+// import groups, in the order they are written.
+const (
+	stdImport = iota
+	thirdPartyImport
+	projectImport
+)
+
+// importClassifier returns a function which reports which group an import
+// path belongs to by resolving it with ctx.
+func importClassifier(ctx *gb.Context) func(string) int {
+	srcdir := filepath.Join(ctx.Projectdir(), "src")
+	return func(path string) int {
+		pkg, err := ctx.ResolvePackage(path)
+		switch {
+		case err != nil:
+			// the package, or one of its dependencies, is missing.
+			// guess using the convention that only third party import
+			// paths outside the project start with a domain name.
+			if _, err := os.Stat(filepath.Join(srcdir, filepath.FromSlash(path))); err == nil {
+				return projectImport
+			}
+			if first := strings.SplitN(path, "/", 2)[0]; strings.Contains(first, ".") {
+				return thirdPartyImport
+			}
+			return stdImport
+		case pkg.Goroot:
+			return stdImport
+		case pkg.SrcRoot == srcdir:
+			return projectImport
+		default:
+			return thirdPartyImport
+		}
+	}
+}
+
+// groupImports rewrites the import declaration of src so imports are
+// grouped by the result of classify, each group sorted by import path.
+// Files with more than one import declaration, an import of "C", or
+// comments within the import declaration are returned unchanged.
+func groupImports(filename string, src []byte, classify func(string) int) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		if decl != nil {
+			return src, nil
+		}
+		decl = d
+	}
+	if decl == nil || !decl.Lparen.IsValid() {
+		return src, nil
+	}
+	for _, c := range f.Comments {
+		if c.Pos() > decl.Pos() && c.End() < decl.End() {
+			return src, nil
+		}
+	}
+
+	var groups [projectImport + 1][]string
+	for _, s := range decl.Specs {
+		spec := s.(*ast.ImportSpec)
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if path == "C" {
+			return src, nil
+		}
+		line := spec.Path.Value
+		if spec.Name != nil {
+			line = spec.Name.Name + " " + line
+		}
+		g := classify(path)
+		groups[g] = append(groups[g], line)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("import (\n")
+	sep := false
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		if sep {
+			buf.WriteString("\n")
+		}
+		sort.Sort(byImportPath(g))
+		for _, line := range g {
+			fmt.Fprintf(&buf, "\t%s\n", line)
+		}
+		sep = true
+	}
+	buf.WriteString(")")
+
+	start := fset.Position(decl.Pos()).Offset
+	end := fset.Position(decl.End()).Offset
+	var out []byte
+	out = append(out, src[:start]...)
+	out = append(out, buf.Bytes()...)
+	out = append(out, src[end:]...)
+	return out, nil
+}
+
+// byImportPath sorts import lines, which may be named, by their path.
+type byImportPath []string
+
+func (b byImportPath) Len() int           { return len(b) }
+func (b byImportPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byImportPath) Less(i, j int) bool { return importPath(b[i]) < importPath(b[j]) }
+
+func importPath(line string) string {
+	return line[strings.Index(line, `"`):]
+}
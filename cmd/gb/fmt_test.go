@@ -0,0 +1,99 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+const unformatted = `package a
+
+import (
+	"b"
+	"github.com/v/x"
+	"os"
+	"fmt"
+)
+
+var (
+ _ = fmt.Println
+ _ = os.Exit
+ _ = b.B
+ _ = x.X
+)
+`
+
+func mkfmtfixture(gb *T) {
+	gb.rawFile("src/a/a.go", unformatted)
+	gb.tempFile("src/b/b.go", "package b\n\nconst B = 1\n")
+	gb.rawFile("vendor/src/github.com/v/x/x.go", "package x\n\nconst  X = 1\n")
+}
+
+func TestFmtCheck(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkfmtfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("fmt", "-check", "all")
+	gb.grepStdout(`^src/a/a.go$`, "expected unformatted file to be listed")
+	gb.grepStdoutNot(`b.go`, "did not expect formatted file to be listed")
+	gb.grepStderr(`1 file\(s\) not formatted`, "expected fmt -check failure")
+	if got := gb.readFile("src/a/a.go"); got != unformatted {
+		t.Fatalf("fmt -check modified file: %q", got)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkfmtfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("fmt")
+	gb.grepStdout(`^src/a/a.go$`, "expected formatted file to be listed")
+	gb.run("fmt", "-check")
+	if got := gb.readFile("vendor/src/github.com/v/x/x.go"); got != "package x\n\nconst  X = 1\n" {
+		t.Fatalf("fmt modified vendored file: %q", got)
+	}
+}
+
+func TestFmtImports(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkfmtfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("fmt", "-imports", "a")
+	want := `package a
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/v/x"
+
+	"b"
+)
+
+var (
+	_ = fmt.Println
+	_ = os.Exit
+	_ = b.B
+	_ = x.X
+)
+`
+	if got := gb.readFile("src/a/a.go"); got != want {
+		t.Fatalf("fmt -imports: want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+// rawFile is like tempFile, but does not format Go source.
+func (t *T) rawFile(path, contents string) {
+	t.tempFile(path, "")
+	t.must(ioutil.WriteFile(t.path(path), []byte(contents), 0644))
+}
+
+func (t *T) readFile(path string) string {
+	b, err := ioutil.ReadFile(t.path(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -1174,6 +1174,65 @@ func TestGbListFormatFromStdin(t *testing.T) {
 	gb.grepStdout("^s$", "expected 's'")
 }
 
+func mklistdepsfixture(gb *T) {
+	gb.tempFile("src/cmd/p/main.go", "package main\n\nimport \"q\"\n\nfunc main() { q.Q() }\n")
+	gb.tempFile("src/q/q.go", "package q\n\nimport \"v\"\n\nfunc Q() { v.V() }\n")
+	gb.tempFile("src/r/r.go", "package r\n\nimport \"strings\"\n\nvar R = strings.ToUpper\n")
+	gb.tempFile("src/r/r_test.go", "package r\n\nimport (\n\t\"testing\"\n\n\t\"q\"\n)\n\nfunc TestR(t *testing.T) { q.Q() }\n")
+	gb.tempFile("vendor/src/v/v.go", "package v\n\nimport \"errors\"\n\nfunc V() error { return errors.New(\"v\") }\n")
+}
+
+func TestGbListDeps(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mklistdepsfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("list", "-deps", "cmd/p")
+	// dependencies are listed before the packages which import them.
+	gb.grepStdout("^errors$", "expected errors")
+	out := gb.stdout.String()
+	if !(strings.Index(out, "\nv\n") < strings.Index(out, "\nq\n") && strings.Index(out, "\nq\n") < strings.Index(out, "\ncmd/p\n")) {
+		t.Fatalf("expected v, q, cmd/p in dependency order, got:\n%s", out)
+	}
+	gb.run("list", "-deps", "-vendor", "-project", "cmd/p")
+	if got, want := gb.stdout.String(), "v\nq\ncmd/p\n"; got != want {
+		t.Fatalf("list -deps -vendor -project: want %q, got %q", want, got)
+	}
+	gb.run("list", "-deps", "-std", "-f", "{{.ImportPath}} {{.Origin}}", "r")
+	gb.grepStdout("^strings std$", "expected strings")
+	gb.grepStdoutNot("^q ", "unexpected test import q")
+	gb.run("list", "-deps", "-test", "-project", "r")
+	gb.grepStdout("^q$", "expected test import q")
+}
+
+func TestGbListRdeps(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mklistdepsfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("list", "-rdeps", "v")
+	if got, want := gb.stdout.String(), "cmd/p\nq\n"; got != want {
+		t.Fatalf("list -rdeps v: want %q, got %q", want, got)
+	}
+	gb.run("list", "-rdeps", "v", "-test")
+	if got, want := gb.stdout.String(), "cmd/p\nq\nr\n"; got != want {
+		t.Fatalf("list -rdeps v -test: want %q, got %q", want, got)
+	}
+	gb.runFail("list", "-deps", "-rdeps", "v")
+
+	// every project package is considered, not only those below the
+	// working directory or named.
+	gb.run("list", "-rdeps", "v", "r")
+	if got, want := gb.stdout.String(), "cmd/p\nq\n"; got != want {
+		t.Fatalf("list -rdeps v r: want %q, got %q", want, got)
+	}
+	gb.cd(gb.path("src", "r"))
+	gb.run("list", "-rdeps", "v")
+	if got, want := gb.stdout.String(), "cmd/p\nq\n"; got != want {
+		t.Fatalf("list -rdeps v in src/r: want %q, got %q", want, got)
+	}
+}
+
 // TODO(dfc) add tests for -json
 
 func skipWindows(t *testing.T, msg string) {
@@ -1802,3 +1861,143 @@ func TestTestWithCxxFiles(t *testing.T) {
 	gb.cd(gb.tempdir)
 	gb.run("test")
 }
+
+func TestBuildOutputFileRequiresOneMainPackage(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/cmd/a/main.go", "package main\nfunc main() {}\n")
+	gb.tempFile("src/cmd/b/main.go", "package main\nfunc main() {}\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("build", "-o", "prog")
+	gb.grepStderr(`-o .*prog requires a single main package, found 2`, "expected -o error")
+	gb.mustNotExist(gb.path("prog"))
+}
+
+func TestBuildInvalidNameTemplate(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/cmd/a/main.go", "package main\nfunc main() {}\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("build", "-name", "{{.Nope}}")
+	gb.grepStderr(`invalid binary name template`, "expected template error")
+}
+
+func TestBuildInternalImport(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/internal/x/x.go", "package x\n\nconst X = 1\n")
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"a/internal/x\"\n\nconst A = x.X\n")
+	gb.tempFile("src/b/b.go", "package b\n\nimport \"a/internal/x\"\n\nconst B = x.X\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("build", "b")
+	gb.grepStderr(`b imports a/internal/x: use of internal package not allowed`, "expected internal import error")
+	gb.run("build", "-allowinternal", "b")
+	gb.grepStdout(`^b$`, "expected b")
+}
+
+func mkshadowfixture(gb *T) {
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"b\"\n\nconst A = b.B\n")
+	gb.tempFile("src/b/b.go", "package b\n\nconst B = \"project\"\n")
+	gb.tempFile("vendor/src/b/b.go", "package b\n\nconst B = \"vendor\"\n")
+}
+
+func TestBuildStrictShadowed(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkshadowfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("build", "-strict", "a")
+	gb.grepStderr(`a imports b, which is provided by more than one root: .*src.b, .*vendor.src.b`, "expected shadowed import error")
+}
+
+func TestGbListShadowed(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkshadowfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("list", "-deps", "-shadowed", "a")
+	gb.grepStdout(`^b$`, "expected b")
+	gb.grepStdoutNot(`^a$`, "a is not shadowed")
+	gb.grepStdout(`^\t\* .*src.b$`, "expected project copy of b in use")
+	gb.grepStdout(`^\t  .*vendor.src.b$`, "expected vendored copy of b")
+}
+
+func TestGbListShadowedOverride(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"github.com/a/b\"\n\nconst A = b.B\n")
+	gb.tempFile("vendor/src/github.com/a/b/b.go", "package b\n\nconst B = \"vendor\"\n")
+	gb.tempFile("mylib/b.go", "package b\n\nconst B = \"override\"\n")
+	gb.tempFile("depfile", "github.com/a/b path=mylib\n")
+	gb.cd(gb.tempdir)
+	gb.run("list", "-deps", "-shadowed", "a")
+	gb.grepStdout(`^github.com/a/b$`, "expected github.com/a/b")
+	gb.grepStdout(`^\t\* .*vendor.src.github.com.a.b$`, "expected vendored copy of github.com/a/b in use")
+	gb.grepStdout(`^\t  .*mylib$`, "expected overridden copy of github.com/a/b")
+	gb.runFail("build", "-strict", "a")
+	gb.grepStderr(`a imports github.com/a/b, which is provided by more than one root: .*vendor.src.github.com.a.b, .*mylib`, "expected shadowed import error")
+}
+
+func mkgopathfixture(gb *T) string {
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"example.com/legacy\"\n\nconst A = legacy.L\n")
+	gopath := gb.tempDir("gopath")
+	gb.tempFile("gopath/src/example.com/legacy/legacy.go", "package legacy\n\nconst L = 1\n")
+	gb.setenv("GOPATH", gopath)
+	return gopath
+}
+
+func TestGbListGopath(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gopath := mkgopathfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("list", "-deps", "a")
+	gb.grepStderr(`import "example.com/legacy": not found`, "expected import error without -gopath")
+	gb.run("list", "-deps", "-gopath", "-f", "{{.ImportPath}} {{.Origin}}", "a")
+	gb.grepStdout(`^example.com/legacy gopath$`, "expected gopath origin")
+	gb.grepStderr(`^warning: 1 package\(s\) resolved from \$GOPATH:$`, "expected gopath warning")
+	gb.grepStderr(`^\texample.com/legacy\t`+regexp.QuoteMeta(filepath.Join(gopath, "src", "example.com", "legacy"))+`$`, "expected gopath package in warning")
+}
+
+func TestGbListGopathDepfile(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkgopathfixture(&gb)
+	gb.tempFile("depfile", "gopath enabled=true\n")
+	gb.cd(gb.tempdir)
+	gb.run("list", "-deps", "-vendor", "a")
+	gb.grepStdout(`^example.com/legacy$`, "expected example.com/legacy")
+	gb.grepStdoutNot(`^a$`, "expected only third party packages")
+}
+
+func TestGbDepfileGopathOption(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkgopathfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("depfile", "add", "gopath", "enabled=yes")
+	gb.grepStderr(`gopath: expected enabled=true or enabled=false, got enabled=yes`, "expected invalid option error")
+	gb.run("depfile", "add", "gopath", "enabled=true")
+	gb.run("list", "-deps", "-vendor", "a")
+	gb.grepStdout(`^example.com/legacy$`, "expected example.com/legacy")
+	gb.run("depfile", "list")
+	gb.grepStdoutNot(`gopath`, "expected no gopath entry")
+	gb.runFail("depfile", "why", "gopath")
+	gb.grepStderr(`gopath is a project option, not a package`, "expected option error")
+
+	gb.tempFile("depfile", "gopath enabled=1\n")
+	gb.runFail("list", "a")
+	gb.grepStderr(`gopath: expected enabled=true or enabled=false, got enabled=1`, "expected invalid option error")
+}
+
+func TestGbListModule(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"github.com/user/lib/v2\"\n\nconst A = lib.V\n")
+	gb.tempFile("go.mod", "module example.com/a\n\nrequire github.com/user/lib/v2 v2.0.1\n")
+	gb.tempFile("modcache/github.com/user/lib/v2@v2.0.1/lib.go", "package lib\n\nconst V = 2\n")
+	gb.setenv("GOMODCACHE", gb.path("modcache"))
+	gb.cd(gb.tempdir)
+	gb.run("list", "-deps", "-f", "{{.ImportPath}} {{.Origin}}", "a")
+	gb.grepStdout(`^github.com/user/lib/v2 module$`, "expected github.com/user/lib/v2 from the module cache")
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+)
+
+var (
+	graphJSON     bool     // emit JSON rather than DOT
+	graphNoStd    bool     // hide standard library packages
+	graphCollapse []string // import path prefixes to collapse into one node
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "graph",
+		UsageLine: "graph [-json] [-nostd] [-collapse prefixes] [packages]",
+		Short:     "print the import graph of packages",
+		Long: `
+Graph prints the resolved import graph of the packages named by the import
+paths, and all of their dependencies, in DOT format.
+
+Each package is annotated with where it was resolved from, std, project,
+vendor, gopath, module, depfile or override, the size of its source files, and
+whether it uses cgo. Packages which use cgo are drawn with a double border.
+
+Imports between packages in different top level directories of $PROJECT/src
+which form a cycle between those directories, for example src/a/x imports
+src/b/y, and src/b/z imports src/a/w, are drawn in red. While not an import
+cycle yet, these are usually a sign that the directories should be merged
+or split differently.
+
+Flags:
+
+	-json
+		print the graph as JSON, rather than DOT.
+	-nostd
+		omit packages from the standard library.
+	-collapse 'prefixes'
+		merge all packages whose import path starts with one of the
+		prefixes into a single node named by the prefix.
+`,
+		Run: graph,
+		AddFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&graphJSON, "json", false, "print the graph as JSON")
+			fs.BoolVar(&graphNoStd, "nostd", false, "omit standard library packages")
+			fs.Var((*stringsFlag)(&graphCollapse), "collapse", "import path prefixes to collapse")
+		},
+	})
+}
+
+// GraphNode is a package, or collapsed group of packages, in the import graph.
+type GraphNode struct {
+	ImportPath string
+	Origin     string   // std, project, vendor, gopath, module, depfile, override, or mixed
+	Cgo        bool     // uses cgo
+	Size       int64    // size of the source files, in bytes
+	Packages   []string `json:",omitempty"` // packages collapsed into this node
+}
+
+// GraphEdge is an import of To by From.
+type GraphEdge struct {
+	From, To string
+	Cycle    bool // part of a cycle between top level directories
+}
+
+// Graph is the import graph printed by gb graph.
+type Graph struct {
+	Nodes  []*GraphNode
+	Edges  []*GraphEdge
+	Cycles [][]string `json:",omitempty"` // top level directories which import each other
+}
+
+func graph(ctx *gb.Context, args []string) error {
+	pkgs, err := resolveRootPackages(ctx, args...)
+	if err != nil {
+		return err
+	}
+	pkgs, err = transitiveDeps(ctx, pkgs, false)
+	if err != nil {
+		return err
+	}
+	g := importGraph(pkgs, graphNoStd, splitList(graphCollapse))
+	if graphJSON {
+		enc := json.NewEncoder(os.Stdout)
+		return enc.Encode(g)
+	}
+	printGraph(os.Stdout, g)
+	return nil
+}
+
+// importGraph builds the import graph of pkgs, which must contain the
+// dependencies of each package.
+func importGraph(pkgs []*gb.Package, nostd bool, collapse []string) *Graph {
+	// name returns the node pkg belongs to.
+	name := func(pkg *gb.Package) string {
+		for _, prefix := range collapse {
+			if pkg.ImportPath == prefix || strings.HasPrefix(pkg.ImportPath, strings.TrimSuffix(prefix, "/")+"/") {
+				return prefix
+			}
+		}
+		return pkg.ImportPath
+	}
+
+	var g Graph
+	nodes := make(map[string]*GraphNode)
+	edges := make(map[[2]string]bool)
+	for _, pkg := range pkgs {
+		if nostd && pkg.Origin() == "std" {
+			continue
+		}
+		n := name(pkg)
+		node, ok := nodes[n]
+		if !ok {
+			node = &GraphNode{ImportPath: n, Origin: pkg.Origin()}
+			nodes[n] = node
+			g.Nodes = append(g.Nodes, node)
+		}
+		if node.Origin != pkg.Origin() {
+			node.Origin = "mixed"
+		}
+		if n != pkg.ImportPath {
+			node.Packages = append(node.Packages, pkg.ImportPath)
+		}
+		node.Cgo = node.Cgo || len(pkg.CgoFiles) > 0
+		node.Size += sourceSize(pkg)
+
+		for _, dep := range pkg.Imports {
+			if dep.ImportPath == "C" || (nostd && dep.Origin() == "std") {
+				continue
+			}
+			e := [2]string{n, name(dep)}
+			if e[0] == e[1] || edges[e] {
+				continue
+			}
+			edges[e] = true
+			g.Edges = append(g.Edges, &GraphEdge{From: e[0], To: e[1]})
+		}
+	}
+	markDirCycles(&g, nodes)
+	return &g
+}
+
+// sourceSize returns the size in bytes of the source files of pkg.
+func sourceSize(pkg *gb.Package) int64 {
+	var size int64
+	for _, files := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles} {
+		for _, file := range files {
+			if fi, err := os.Stat(filepath.Join(pkg.Dir, file)); err == nil {
+				size += fi.Size()
+			}
+		}
+	}
+	return size
+}
+
+// topdir returns the top level directory of a project import path.
+func topdir(path string) string {
+	return strings.SplitN(path, "/", 2)[0]
+}
+
+// markDirCycles finds sets of top level project directories which import
+// each other, and marks the edges between them.
+func markDirCycles(g *Graph, nodes map[string]*GraphNode) {
+	// graph of top level directories.
+	dirs := make(map[string]map[string]bool)
+	for _, e := range g.Edges {
+		from, to := nodes[e.From], nodes[e.To]
+		if from == nil || to == nil || from.Origin != "project" || to.Origin != "project" {
+			continue
+		}
+		a, b := topdir(e.From), topdir(e.To)
+		if a == b {
+			continue
+		}
+		if dirs[a] == nil {
+			dirs[a] = make(map[string]bool)
+		}
+		dirs[a][b] = true
+	}
+
+	// strongly connected components of more than one directory are cycles.
+	scc := stronglyConnected(dirs)
+	component := make(map[string]int)
+	for i, c := range scc {
+		if len(c) < 2 {
+			continue
+		}
+		g.Cycles = append(g.Cycles, c)
+		for _, dir := range c {
+			component[dir] = i + 1
+		}
+	}
+	for _, e := range g.Edges {
+		from, to := nodes[e.From], nodes[e.To]
+		if from == nil || to == nil || from.Origin != "project" || to.Origin != "project" {
+			continue
+		}
+		a, b := topdir(e.From), topdir(e.To)
+		e.Cycle = a != b && component[a] != 0 && component[a] == component[b]
+	}
+}
+
+// stronglyConnected returns the strongly connected components of the graph
+// g, each sorted, using Tarjan's algorithm.
+func stronglyConnected(g map[string]map[string]bool) [][]string {
+	var vertices []string
+	for v := range g {
+		vertices = append(vertices, v)
+	}
+	sort.Strings(vertices)
+
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onstack := make(map[string]bool)
+	var stack []string
+	var sccs [][]string
+	var strongconnect func(v string)
+	strongconnect = func(v string) {
+		index[v] = len(index) + 1
+		low[v] = index[v]
+		stack = append(stack, v)
+		onstack[v] = true
+
+		var succ []string
+		for w := range g[v] {
+			succ = append(succ, w)
+		}
+		sort.Strings(succ)
+		for _, w := range succ {
+			switch {
+			case index[w] == 0:
+				strongconnect(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			case onstack[w] && index[w] < low[v]:
+				low[v] = index[w]
+			}
+		}
+
+		if low[v] == index[v] {
+			var c []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onstack[w] = false
+				c = append(c, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Strings(c)
+			sccs = append(sccs, c)
+		}
+	}
+	for _, v := range vertices {
+		if index[v] == 0 {
+			strongconnect(v)
+		}
+	}
+	return sccs
+}
+
+// originColors are the fill colors of nodes by origin.
+var originColors = map[string]string{
+	"std":      "lightgrey",
+	"project":  "lightblue",
+	"vendor":   "khaki",
+	"gopath":   "palegreen",
+	"module":   "plum",
+	"depfile":  "lightsalmon",
+	"override": "orange",
+	"mixed":    "white",
+}
+
+// printGraph writes g to w in DOT format.
+func printGraph(w io.Writer, g *Graph) {
+	fmt.Fprintf(w, "digraph %q {\n", "imports")
+	fmt.Fprintf(w, "\tnode [shape=box, style=filled];\n")
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q, fillcolor=%s", fmt.Sprintf("%s\n%s, %s", n.ImportPath, n.Origin, gb.FormatSize(n.Size)), originColors[n.Origin])
+		if n.Cgo {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(w, "\t%q [%s];\n", n.ImportPath, attrs)
+	}
+	for _, e := range g.Edges {
+		if e.Cycle {
+			fmt.Fprintf(w, "\t%q -> %q [color=red];\n", e.From, e.To)
+			continue
+		}
+		fmt.Fprintf(w, "\t%q -> %q;\n", e.From, e.To)
+	}
+	fmt.Fprintf(w, "}\n")
+}
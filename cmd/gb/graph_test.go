@@ -0,0 +1,65 @@
+package main_test
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mkgraphfixture(gb *T) {
+	gb.tempFile("src/a/x/x.go", "package x\n\nimport \"b/y\"\n\nvar X = y.Y\n")
+	gb.tempFile("src/a/w/w.go", "package w\n\nimport \"fmt\"\n\nvar W = fmt.Sprint\n")
+	gb.tempFile("src/b/y/y.go", "package y\n\nconst Y = 1\n")
+	gb.tempFile("src/b/z/z.go", "package z\n\nimport (\n\t\"a/w\"\n\t\"v/u\"\n)\n\nvar Z, U = w.W, u.U\n")
+	gb.tempFile("vendor/src/v/u/u.go", "package u\n\nconst U = 2\n")
+}
+
+func TestGraph(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkgraphfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("graph", "all")
+	gb.grepStdout(`^digraph "imports" {$`, "expected dot graph")
+	gb.grepStdout(`^\t"fmt" \[label="fmt\\nstd, .*fillcolor=lightgrey\];$`, "expected fmt node")
+	gb.grepStdout(`^\t"v/u" \[label="v/u\\nvendor, .*\];$`, "expected vendored node")
+	gb.grepStdout(`^\t"a/x" -> "b/y" \[color=red\];$`, "expected a -> b cycle edge")
+	gb.grepStdout(`^\t"b/z" -> "a/w" \[color=red\];$`, "expected b -> a cycle edge")
+	gb.grepStdout(`^\t"b/z" -> "v/u";$`, "expected plain edge to vendored package")
+}
+
+func TestGraphJSON(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkgraphfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("graph", "-json", "-nostd", "-collapse", "a b", "all")
+	var g struct {
+		Nodes []struct {
+			ImportPath, Origin string
+			Packages           []string
+		}
+		Edges []struct {
+			From, To string
+			Cycle    bool
+		}
+		Cycles [][]string
+	}
+	if err := json.Unmarshal(gb.stdout.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]string)
+	for _, n := range g.Nodes {
+		nodes[n.ImportPath] = n.Origin
+	}
+	if len(nodes) != 3 || nodes["a"] != "project" || nodes["b"] != "project" || nodes["v/u"] != "vendor" {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	if len(g.Cycles) != 1 || len(g.Cycles[0]) != 2 {
+		t.Fatalf("expected one cycle between a and b, got %v", g.Cycles)
+	}
+	for _, e := range g.Edges {
+		if want := e.To != "v/u"; e.Cycle != want {
+			t.Errorf("edge %s -> %s: want cycle %v", e.From, e.To, want)
+		}
+	}
+}
@@ -17,6 +17,9 @@ import (
 
 func init() {
 	registerCommand(helpProject)
+	registerCommand(helpModules)
+	registerCommand(helpOffline)
+	registerCommand(helpAuth)
 }
 
 var helpProject = &cmd.Command{
@@ -33,6 +36,92 @@ can be used to supply a project root.
 See http://getgb.io/docs/project for details`,
 }
 
+var helpOffline = &cmd.Command{
+	Name:  "offline",
+	Short: "building without network access",
+	Long: `Setting GB_OFFLINE to any value other than 0, or passing the -offline flag
+to any command, disables network access. Depfile entries which are not in
+$GB_HOME/cache, or in the mirror named by GB_MIRROR, are reported as
+missing rather than fetched, as are the releases of version constraints
+which are not recorded in depfile.lock. gb vendor does not fetch remote
+metadata, and only checks out repositories with file:// URLs.
+
+GB_MIRROR names a directory, or the http:// or https:// URL of a server,
+holding an archive of the content of depfile entries. Entries missing from
+$GB_HOME/cache are fetched from the mirror when it has them, and from
+their upstream repositories otherwise, unless offline. The content fetched
+from a mirror is verified against depfile.lock as usual.
+
+To populate a mirror, run
+
+	gb depfile download dir
+
+on a machine with network access, which fetches each entry in use by the
+project and writes an archive of each to dir. Mirrors written for several
+projects may share a directory.`,
+}
+
+var helpAuth = &cmd.Command{
+	Name:  "auth",
+	Short: "credentials for private repositories",
+	Long: `gb sends credentials when downloading depfile entries, when fetching the
+go-import metadata of import paths, and when probing and cloning git
+repositories over https, so private repositories and import servers can be
+used. The credentials for a host are taken from the first of these which
+has an entry for it:
+
+$GB_HOME/auth, in the same format as a depfile, with a token, or a user
+and password, for each host:
+
+	github.example.com token=0123456789abcdef
+	git.example.com user=builder password="s3cret phrase"
+
+An entry for host:port only applies to that port.
+
+GB_GITHUB_TOKEN, GB_GITLAB_TOKEN and GB_BITBUCKET_TOKEN, which hold a
+token for github.com, gitlab.com and bitbucket.org respectively, and their
+APIs. Setting GB_GITHUB_TOKEN also avoids the rate limit GitHub applies to
+anonymous requests, which gb makes to list the releases of version
+constraints.
+
+$NETRC, or ~/.netrc if it is not set, whose login and password are used
+for matching machine entries, and for the default entry.
+
+Tokens are sent as bearer tokens over HTTP. Git only supports basic
+authentication, so to git a token is sent as the password of the user in
+$GB_HOME/auth, or of the user the forge expects. Credentials are passed to
+git in its environment, and are not visible on its command line. Mercurial
+and bazaar repositories use their own configuration.`,
+}
+
+var helpModules = &cmd.Command{
+	Name:  "modules",
+	Short: "using Go modules as dependencies",
+	Long: `gb can build packages from Go modules which are already present in the
+module cache, $GOMODCACHE, or $GOPATH/pkg/mod if it is not set.
+
+The modules used are those named by the require directives of
+$PROJECT/go.mod, and by depfile entries with a module key:
+
+	github.com/pkg/errors module=v0.8.0
+
+The replace and exclude directives are not supported, and are reported as
+errors rather than silently building different code to the go command.
+Other go.mod directives are ignored, as are the go.mod files of the
+required modules themselves; every module needed must be required by the
+project.
+
+An import path is resolved from the required module with the longest
+matching path, so github.com/user/lib/v2/pkg is found in the module
+github.com/user/lib/v2. Versions of v2 and above must match the major
+version suffix of the module path, unless marked +incompatible.
+
+If a module has not been extracted, but its zip file is present in the
+download cache of the module cache, or of $GB_HOME/mod, it is unpacked into
+$GB_HOME/mod. gb never downloads modules; use 'go mod download' to populate
+the module cache, after which builds work offline.`,
+}
+
 var helpTemplate = `{{if .Runnable}}usage: gb {{.UsageLine}}
 
 {{end}}{{.Long | trim}}
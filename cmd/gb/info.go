@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/constabulary/gb"
@@ -30,6 +31,9 @@ Values:
 		The suffix applied any binary written to $GB_PROJECT_DIR/bin
 	GB_GOROOT
 		The value of runtime.GOROOT for the Go version that built this copy of gb.
+	GB_DEPFILE_OVERRIDES
+		The list of depfile entries replaced by local directories, each
+		written prefix=dir.
 
 info returns 0 if the project is well formed, and non zero otherwise.
 If one or more variable names is given as arguments, info prints the 
@@ -87,5 +91,17 @@ func makeenv(ctx *gb.Context) []envvar {
 		{"GB_PKG_DIR", ctx.Pkgdir()},
 		{"GB_BIN_SUFFIX", ctx.Suffix()},
 		{"GB_GOROOT", runtime.GOROOT()},
+		{"GB_DEPFILE_OVERRIDES", joinlist(overrides(ctx)...)},
 	}
 }
+
+// overrides returns the depfile overrides of ctx, written prefix=dir and
+// sorted by prefix.
+func overrides(ctx *gb.Context) []string {
+	var list []string
+	for prefix, dir := range ctx.Overrides() {
+		list = append(list, prefix+"="+dir)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/constabulary/gb"
 	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/test"
 	"github.com/pkg/errors"
 )
 
@@ -20,12 +21,20 @@ var (
 	format      string
 	formatStdin bool
 	jsonOutput  bool
+
+	listDeps    bool   // list the transitive dependencies of the packages
+	listRdeps   string // list the packages which depend on this package
+	listTest    bool   // include test imports with -deps and -rdeps
+	listStd     bool   // list only standard library packages
+	listVendor  bool   // list only vendored and depfile packages
+	listProject bool   // list only project packages
+	listShadow  bool   // list only packages provided by more than one root
 )
 
 func init() {
 	registerCommand(&cmd.Command{
 		Name:      "list",
-		UsageLine: `list [-s] [-f format] [-json] [packages]`,
+		UsageLine: `list [-s] [-f format] [-json] [-deps | -rdeps pkg] [-test] [-std] [-vendor] [-project] [-shadowed] [-gopath] [packages]`,
 		Short:     "list the packages named by the importpaths",
 		Long: `
 List lists packages imported by the project.
@@ -51,12 +60,52 @@ Flags:
 	-json
 		prints output in structured JSON format. WARNING: gb.Package
 		structure is not stable and will change in the future!
+	-deps
+		list the named packages and all of their dependencies, direct or
+		indirect, in dependency order; each package is listed after the
+		packages it imports.
+	-rdeps pkg
+		list every package in $PROJECT/src which depends on pkg directly
+		or indirectly, wherever in the project gb is run. Any packages
+		named are ignored.
+	-test
+		with -deps or -rdeps, also follow the test imports of the packages
+		listed.
+	-std
+		list only packages from the standard library.
+	-vendor
+		list only packages from $PROJECT/vendor/src, $GOPATH, the depfile
+		cache, the module cache or a depfile override.
+	-project
+		list only packages from $PROJECT/src.
+	-shadowed
+		list only packages whose import path is provided by more than one
+		of GOROOT, $PROJECT/src, $PROJECT/vendor/src, $GOPATH if enabled,
+		the depfile cache, required modules and depfile overrides, each
+		followed by the directories providing it, the one in use
+		marked with a *. Usually combined with -deps. With -json the
+		directories are listed in the Shadows field.
+	-gopath
+		resolve packages not found in the project from $GOPATH, as
+		'gb build -gopath' does. Packages resolved from $GOPATH have the
+		origin "gopath", and are summarised in a warning.
+
+The -std, -vendor and -project filters may be combined, in which case
+packages matching any of them are listed.
 `,
 		Run: list,
 		AddFlags: func(fs *flag.FlagSet) {
 			fs.StringVar(&format, "f", "{{.ImportPath}}", "format template")
 			fs.BoolVar(&formatStdin, "s", false, "read format from stdin")
 			fs.BoolVar(&jsonOutput, "json", false, "outputs json. WARNING: gb.Package structure is not stable and will change in future")
+			fs.BoolVar(&listDeps, "deps", false, "list transitive dependencies")
+			fs.StringVar(&listRdeps, "rdeps", "", "list packages which depend on this package")
+			fs.BoolVar(&listTest, "test", false, "include test imports with -deps or -rdeps")
+			fs.BoolVar(&listStd, "std", false, "list only standard library packages")
+			fs.BoolVar(&listVendor, "vendor", false, "list only vendored packages")
+			fs.BoolVar(&listProject, "project", false, "list only project packages")
+			fs.BoolVar(&listShadow, "shadowed", false, "list only packages provided by more than one root")
+			fs.BoolVar(&useGopath, "gopath", false, "fall back to $GOPATH for packages not in the project")
 		},
 	})
 }
@@ -67,15 +116,42 @@ func list(ctx *gb.Context, args []string) error {
 		io.Copy(&formatBuffer, os.Stdin)
 		format = formatBuffer.String()
 	}
-	pkgs, err := resolveRootPackages(ctx, args...)
+	var r Resolver = ctx
+	if listTest {
+		r = test.TestResolver(ctx)
+	}
+	pkgs, err := resolveRootPackages(r, args...)
 	if err != nil {
 		log.Fatalf("unable to resolve: %v", err)
 	}
 
+	switch {
+	case listDeps && listRdeps != "":
+		return errors.New("-deps and -rdeps are mutually exclusive")
+	case listDeps:
+		pkgs, err = transitiveDeps(ctx, pkgs, listTest)
+	case listRdeps != "":
+		pkgs, err = reverseDeps(ctx, listRdeps, listTest)
+	}
+	if err != nil {
+		return err
+	}
+	pkgs = filterOrigin(pkgs, listStd, listVendor, listProject)
+	if err := warnGopath(ctx, pkgs); err != nil {
+		return err
+	}
+	if listShadow {
+		pkgs = filterShadowed(ctx, pkgs)
+	}
+
 	if jsonOutput {
 		views := make([]*PackageView, 0, len(pkgs))
 		for _, pkg := range pkgs {
-			views = append(views, NewPackageView(pkg))
+			view := NewPackageView(pkg)
+			if listShadow {
+				view.Shadows = ctx.Shadows(pkg.ImportPath)
+			}
+			views = append(views, view)
 		}
 		encoder := json.NewEncoder(os.Stdout)
 		if err := encoder.Encode(views); err != nil {
@@ -95,6 +171,16 @@ func list(ctx *gb.Context, args []string) error {
 				return errors.Wrap(err, "unable to execute template")
 			}
 			fmt.Fprintln(os.Stdout)
+			if !listShadow {
+				continue
+			}
+			for _, dir := range ctx.Shadows(pkg.ImportPath) {
+				used := " "
+				if dir == pkg.Dir {
+					used = "*"
+				}
+				fmt.Fprintf(os.Stdout, "\t%s %s\n", used, dir)
+			}
 		}
 	}
 	return nil
@@ -107,10 +193,12 @@ type PackageView struct {
 	ImportPath  string
 	Name        string
 	Root        string
+	Origin      string
 	GoFiles     []string
 	Imports     []string
 	TestGoFiles []string
 	TestImports []string
+	Shadows     []string `json:",omitempty"`
 }
 
 // NewPackageView creates a *PackageView from gb Package.
@@ -120,9 +208,156 @@ func NewPackageView(pkg *gb.Package) *PackageView {
 		ImportPath:  pkg.ImportPath,
 		Name:        pkg.Name,
 		Root:        pkg.Root,
+		Origin:      pkg.Origin(),
 		GoFiles:     pkg.GoFiles,
 		Imports:     pkg.Package.Imports,
 		TestGoFiles: pkg.TestGoFiles,
 		TestImports: pkg.TestImports,
 	}
 }
+
+// testImports resolves the test imports of pkg, excluding pkg itself, which
+// is imported by its external tests.
+func testImports(ctx *gb.Context, pkg *gb.Package) ([]*gb.Package, error) {
+	var imports []string
+	imports = append(imports, pkg.TestImports...)
+	imports = append(imports, pkg.XTestImports...)
+	var pkgs []*gb.Package
+	for _, path := range imports {
+		if path == pkg.ImportPath {
+			continue
+		}
+		p, err := ctx.ResolvePackage(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve import path %q", path)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// transitiveDeps returns roots and all of their dependencies, each package
+// following those it imports. If tests is true, the test imports of roots
+// are followed too.
+func transitiveDeps(ctx *gb.Context, roots []*gb.Package, tests bool) ([]*gb.Package, error) {
+	var deps []*gb.Package
+	seen := make(map[string]bool)
+	var visit func(pkg *gb.Package)
+	visit = func(pkg *gb.Package) {
+		if seen[pkg.ImportPath] || pkg.ImportPath == "C" {
+			return
+		}
+		seen[pkg.ImportPath] = true
+		for _, dep := range pkg.Imports {
+			visit(dep)
+		}
+		deps = append(deps, pkg)
+	}
+	for _, root := range roots {
+		if tests {
+			imports, err := testImports(ctx, root)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range imports {
+				visit(dep)
+			}
+		}
+		visit(root)
+	}
+	return deps, nil
+}
+
+// reverseDeps returns the packages in $PROJECT/src which depend, directly
+// or indirectly, on the package at path. If tests is true, the test imports
+// of those packages are considered too.
+func reverseDeps(ctx *gb.Context, path string, tests bool) ([]*gb.Package, error) {
+	target, err := ctx.ResolvePackage(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve import path %q", path)
+	}
+	pkgs, err := projectPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	memo := make(map[string]bool) // import paths to whether they depend on target
+	var dependsOn func(pkg *gb.Package) bool
+	dependsOn = func(pkg *gb.Package) bool {
+		if v, ok := memo[pkg.ImportPath]; ok {
+			return v
+		}
+		memo[pkg.ImportPath] = false
+		for _, dep := range pkg.Imports {
+			if dep.ImportPath == target.ImportPath || dependsOn(dep) {
+				memo[pkg.ImportPath] = true
+				break
+			}
+		}
+		return memo[pkg.ImportPath]
+	}
+
+	var rdeps []*gb.Package
+	for _, pkg := range pkgs {
+		if pkg.ImportPath == target.ImportPath {
+			continue
+		}
+		found := dependsOn(pkg)
+		if !found && tests {
+			imports, err := testImports(ctx, pkg)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range imports {
+				if dep.ImportPath == target.ImportPath || dependsOn(dep) {
+					found = true
+					break
+				}
+			}
+		}
+		if found {
+			rdeps = append(rdeps, pkg)
+		}
+	}
+	return rdeps, nil
+}
+
+// filterOrigin returns the packages in pkgs resolved from the standard
+// library, vendor or depfile, or the project, as requested. If no filter is
+// requested pkgs is returned unchanged.
+func filterOrigin(pkgs []*gb.Package, std, vendor, project bool) []*gb.Package {
+	if !std && !vendor && !project {
+		return pkgs
+	}
+	var out []*gb.Package
+	for _, pkg := range pkgs {
+		switch pkg.Origin() {
+		case "std":
+			if !std {
+				continue
+			}
+		case "vendor", "gopath", "module", "depfile", "override":
+			if !vendor {
+				continue
+			}
+		case "project":
+			if !project {
+				continue
+			}
+		}
+		out = append(out, pkg)
+	}
+	return out
+}
+
+// filterShadowed returns the packages in pkgs whose import path is provided
+// by more than one source root.
+func filterShadowed(ctx *gb.Context, pkgs []*gb.Package) []*gb.Package {
+	var out []*gb.Package
+	for _, pkg := range pkgs {
+		if len(ctx.Shadows(pkg.ImportPath)) > 1 {
+			out = append(out, pkg)
+		}
+	}
+	return out
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/constabulary/gb"
 	"github.com/constabulary/gb/cmd"
 	"github.com/constabulary/gb/cmd/gb/internal/match"
+	"github.com/constabulary/gb/internal/buildcache"
 )
 
 // disable to keep working directory
@@ -18,6 +19,9 @@ const destroyContext = true
 
 var commands = make(map[string]*cmd.Command)
 
+// debug enables debug output, set by the -d flag.
+var debug bool
+
 // registerCommand registers a command for main.
 // registerCommand should only be called from init().
 func registerCommand(command *cmd.Command) {
@@ -47,7 +51,8 @@ func main() {
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	var cwd string
 	fs.StringVar(&cwd, "R", cmd.MustGetwd(), "set the project root") // actually the working directory to start the project root search
-	debug := fs.Bool("d", os.Getenv("DEBUG") != "", "enable debug output")
+	fs.BoolVar(&debug, "d", os.Getenv("DEBUG") != "", "enable debug output")
+	offline := fs.Bool("offline", false, "disable network access, as if GB_OFFLINE were set")
 	fs.Usage = usage
 
 	args := os.Args
@@ -74,6 +79,11 @@ func main() {
 	// reset args to the leftovers from fs.Parse
 	args = fs.Args()
 
+	if *offline {
+		// set in the environment so plugins are offline too.
+		os.Setenv("GB_OFFLINE", "1")
+	}
+
 	// if this is the plugin command, ensure the name of the
 	// plugin is first in the list of arguments.
 	if command == commands["plugin"] {
@@ -87,7 +97,7 @@ func main() {
 	}
 
 	// construct a project context at the current working directory.
-	ctx, err := newContext(cwd, *debug)
+	ctx, err := newContext(cwd, debug)
 	if err != nil {
 		fatalf("unable to construct context: %v", err)
 	}
@@ -171,14 +181,24 @@ func setCommandDefaults(command *cmd.Command) {
 	}
 }
 
-func newContext(cwd string, debug bool) (*gb.Context, error) {
-	return cmd.NewContext(
-		cwd, // project root
+// newContext returns a Context for the project containing cwd, configured
+// by the flags given to gb and then by opts.
+func newContext(cwd string, debug bool, opts ...func(*gb.Context) error) (*gb.Context, error) {
+	opts = append([]func(*gb.Context) error{
 		gb.GcToolchain(),
 		gb.Gcflags(gcflags...),
 		gb.Ldflags(ldflags...),
 		gb.Tags(buildtags...),
 		debugOption(debug),
+		cacheOption(),
+		outputOption(),
+		optionIf(allowInternal, gb.AllowInternal),
+		optionIf(strict, gb.Strict),
+		optionIf(useGopath, gb.WithGOPATH),
+		optionIf(skipDepfile, gb.SkipDepfile),
+		optionIf(relock, gb.IgnoreDepfileLock),
+		optionIf(update, gb.UpdateDepfile(updatePrefixes...)),
+		optionIf(P > 0, gb.FetchJobs(P)),
 		func(c *gb.Context) error {
 			if !race {
 				return nil
@@ -203,7 +223,37 @@ func newContext(cwd string, debug bool) (*gb.Context, error) {
 
 			return gb.WithRace(c)
 		},
-	)
+	}, opts...)
+	return cmd.NewContext(cwd, opts...)
+}
+
+func cacheOption() func(*gb.Context) error {
+	if cacheURL != "" {
+		return gb.WithCache(buildcache.NewHTTP(cacheURL))
+	}
+	return func(*gb.Context) error { return nil }
+}
+
+func outputOption() func(*gb.Context) error {
+	return func(c *gb.Context) error {
+		if output != "" {
+			if err := gb.Output(output)(c); err != nil {
+				return err
+			}
+		}
+		if binname != "" {
+			return gb.BinName(binname)(c)
+		}
+		return nil
+	}
+}
+
+// optionIf returns opt if cond is true, otherwise an option which does nothing.
+func optionIf(cond bool, opt func(*gb.Context) error) func(*gb.Context) error {
+	if cond {
+		return opt
+	}
+	return func(*gb.Context) error { return nil }
 }
 
 func debugOption(debug bool) func(*gb.Context) error {
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/cmd/gb/internal/match"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(runCmd)
+}
+
+var runCmd = &cmd.Command{
+	Name:      "run",
+	UsageLine: "run [build flags] <package | files.go> [--] [arguments...]",
+	Short:     "compile and run a program",
+	Long: `
+Run compiles the named main package, or the main package formed by the
+named .go files, and runs the resulting program with the supplied arguments.
+
+The program is linked into the context's temporary working directory, not
+$PROJECT/bin, and is removed when gb exits. Standard input, output and
+error are connected to the program, signals received by gb are forwarded
+to it, and gb exits with the program's exit status.
+
+Arguments following the package are passed to the program. A -- may be
+used to separate the package from arguments which look like .go files.
+
+The build flags are shared by the build and test commands. For more
+information, run 'gb help build'.
+`,
+	Run:           run,
+	AddFlags:      addBuildFlags,
+	SkipParseArgs: true,
+}
+
+func run(ctx *gb.Context, args []string) error {
+	ctx.Force = F
+	ctx.Install = !FF
+
+	args, progargs := splitRunArgs(args)
+	pkg, err := resolveRunPackage(ctx, args)
+	if err != nil {
+		return err
+	}
+	if !pkg.Main {
+		return errors.Errorf("%s is not a main package", pkg.ImportPath)
+	}
+
+	// create a test scoped copy of the package, so it is linked into
+	// the context's working directory rather than $PROJECT/bin.
+	runpkg, err := ctx.NewPackage(pkg.Package)
+	if err != nil {
+		return err
+	}
+	runpkg.TestScope = true
+	runpkg.Main = true
+
+	targets := make(map[string]*gb.Action)
+	deps, err := gb.BuildDependencies(targets, runpkg)
+	if err != nil {
+		return err
+	}
+	build, err := gb.Compile(runpkg, deps...)
+	if err != nil {
+		return err
+	}
+
+	startSigHandlers()
+	if err := gb.ExecuteConcurrent(build, P, interrupted); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(runpkg.Binfile(), progargs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	ctx.Debug("%s", cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// forward any signals received to the program.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signalsToForward...)
+	go func() {
+		for s := range sig {
+			cmd.Process.Signal(s)
+		}
+	}()
+	err = cmd.Wait()
+	signal.Stop(sig)
+	close(sig)
+
+	if err, ok := err.(*exec.ExitError); ok {
+		if status, ok := err.Sys().(syscall.WaitStatus); ok {
+			exit(status.ExitStatus())
+		}
+	}
+	return err
+}
+
+// splitRunArgs splits args into the package, or list of .go files, to build
+// and the arguments to pass to the program.
+func splitRunArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	i := 0
+	for i < len(args) && strings.HasSuffix(args[i], ".go") {
+		i++
+	}
+	if i == 0 && len(args) > 0 {
+		// not a list of files, the first argument is the package.
+		i = 1
+	}
+	return args[:i], args[i:]
+}
+
+// resolveRunPackage resolves args, either a single import path or a list of
+// .go files, into a package.
+func resolveRunPackage(ctx *gb.Context, args []string) (*gb.Package, error) {
+	switch {
+	case len(args) == 0:
+		return nil, errors.New("no package or .go files supplied")
+	case strings.HasSuffix(args[0], ".go"):
+		return resolveFilesPackage(ctx, args)
+	case len(args) > 1:
+		return nil, errors.Errorf("expected one package, got %q", args)
+	}
+
+	srcdir := filepath.Join(ctx.Projectdir(), "src")
+	paths := match.ImportPaths(srcdir, cmd.MustGetwd(), args)
+	if len(paths) != 1 {
+		return nil, errors.Errorf("%q matched %d packages, expected one", args[0], len(paths))
+	}
+	pkg, err := ctx.ResolvePackage(paths[0])
+	return pkg, errors.Wrapf(err, "failed to resolve import path %q", paths[0])
+}
+
+// resolveFilesPackage synthesises a main package from a list of .go files
+// in a single directory.
+func resolveFilesPackage(ctx *gb.Context, files []string) (*gb.Package, error) {
+	var dir string
+	var gofiles []string
+	imports := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") {
+			return nil, errors.Errorf("%q is not a .go file", file)
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			dir = filepath.Dir(path)
+		}
+		if filepath.Dir(path) != dir {
+			return nil, errors.Errorf("named files must all be in one directory; have %s and %s", dir, filepath.Dir(path))
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name != "main" {
+			return nil, errors.Errorf("%s: expected package main, found %s", file, f.Name.Name)
+		}
+		for _, im := range f.Imports {
+			path, err := strconv.Unquote(im.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			imports[path] = true
+		}
+		gofiles = append(gofiles, filepath.Base(path))
+	}
+
+	// resolve each import so it is present in the context's package cache.
+	var paths []string
+	for path := range imports {
+		pkg, err := ctx.ResolvePackage(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve import path %q", path)
+		}
+		paths = append(paths, pkg.ImportPath)
+	}
+	sort.Strings(paths)
+
+	pkg, err := ctx.NewPackage(&build.Package{
+		Name:       "main",
+		ImportPath: "command-line-arguments",
+		Dir:        dir,
+		GoFiles:    gofiles,
+		Imports:    paths,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pkg.Main = true
+	return pkg, nil
+}
@@ -0,0 +1,59 @@
+package main_test
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const runMain = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("hello", os.Args[1:])
+	if len(os.Args) > 1 && os.Args[1] == "fail" {
+		os.Exit(3)
+	}
+}
+`
+
+func TestRunPackage(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/cmd/hello/main.go", runMain)
+	gb.cd(gb.tempdir)
+	gb.run("run", "cmd/hello", "a", "b")
+	gb.grepStdout(`^hello \[a b\]$`, "expected program output")
+	gb.mustNotExist(filepath.Join(gb.tempdir, "bin"))
+}
+
+func TestRunFiles(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/cmd/hello/main.go", runMain)
+	gb.cd(filepath.Join(gb.tempdir, "src", "cmd", "hello"))
+	gb.run("run", "main.go", "--", "x.go")
+	gb.grepStdout(`^hello \[x.go\]$`, "expected program output")
+}
+
+func TestRunExitStatus(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/cmd/hello/main.go", runMain)
+	gb.cd(gb.tempdir)
+	if status := gb.doRun([]string{"run", "cmd/hello", "fail"}); status == nil || status.Error() != "exit status 3" {
+		t.Fatalf("expected exit status 3, got %v", status)
+	}
+}
+
+func TestRunNotMain(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/a.go", "package a\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("run", "a")
+	gb.grepStderr(`a is not a main package`, "expected not a main package error")
+}
@@ -12,6 +12,9 @@ import (
 
 var signalsToIgnore = []os.Signal{os.Interrupt}
 
+// signalsToForward are the signals gb run passes on to the program.
+var signalsToForward = []os.Signal{os.Interrupt}
+
 // signalTrace is the signal to send to make a Go program
 // crash with a stack trace.
 var signalTrace os.Signal = nil
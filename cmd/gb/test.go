@@ -9,6 +9,7 @@ import (
 	"github.com/constabulary/gb"
 	"github.com/constabulary/gb/cmd"
 	"github.com/constabulary/gb/test"
+	"github.com/constabulary/gb/vet"
 )
 
 func init() {
@@ -22,6 +23,7 @@ var (
 	testCoverPkg  string
 	testVerbose   bool // enable verbose output of test commands
 	testNope      bool // do not execute test binaries, compile and link only
+	testVet       bool // vet packages before testing
 )
 
 func addTestFlags(fs *flag.FlagSet) {
@@ -31,11 +33,12 @@ func addTestFlags(fs *flag.FlagSet) {
 	fs.StringVar(&testCoverPkg, "coverpkg", "", "enable coverage analysis")
 	fs.BoolVar(&testVerbose, "v", false, "enable verbose output of subcommands")
 	fs.BoolVar(&testNope, "n", false, "do not execute test binaries, compile only")
+	fs.BoolVar(&testVet, "vet", false, "vet packages before testing")
 }
 
 var testCmd = &cmd.Command{
 	Name:      "test",
-	UsageLine: "test [build flags] -n -v [packages] [flags for test binary]",
+	UsageLine: "test [build flags] -n -v -vet [packages] [flags for test binary]",
 	Short:     "test packages",
 	Long: `
 Test automates testing the packages named by the import paths.
@@ -49,6 +52,9 @@ Flags:
                 print output from test subprocess.
 	-n
 		do not execute test binaries, compile only
+	-vet
+		vet the packages before testing them, see 'gb help vet'. Tests
+		are not run if vet reports any problems.
 `,
 	Run: func(ctx *gb.Context, args []string) error {
 		ctx.Force = F
@@ -67,12 +73,26 @@ Flags:
 		if err != nil {
 			return err
 		}
+		if err := warnGopath(ctx, pkgs); err != nil {
+			return err
+		}
 
 		test, err := test.TestPackages(TestFlags(tfs), pkgs...)
 		if err != nil {
 			return err
 		}
 
+		if testVet {
+			vet, err := vet.VetPackages(pkgs...)
+			if err != nil {
+				return err
+			}
+			// run each test only once vet has passed.
+			for _, a := range test.Deps {
+				a.Deps = append(a.Deps, vet)
+			}
+		}
+
 		if dotfile != "" {
 			f, err := os.Create(dotfile)
 			if err != nil {
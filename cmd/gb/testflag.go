@@ -18,20 +18,25 @@ type testFlagSpec struct {
 // testFlagDefn is the set of flags we process.
 var testFlagDefn = map[string]*testFlagSpec{
 	// local to the test plugin
-	"cover":     {boolVar: true},
-	"coverpkg":  {},
-	"covermode": {},
-	"a":         {boolVar: true},
-	"r":         {boolVar: true},
-	"f":         {boolVar: true},
-	"F":         {boolVar: true},
-	"n":         {},
-	"P":         {},
-	"ldflags":   {},
-	"gcflags":   {},
-	"dotfile":   {},
-	"tags":      {},
-	"race":      {},
+	"cover":         {boolVar: true},
+	"coverpkg":      {},
+	"covermode":     {},
+	"a":             {boolVar: true},
+	"r":             {boolVar: true},
+	"f":             {boolVar: true},
+	"F":             {boolVar: true},
+	"n":             {},
+	"P":             {},
+	"ldflags":       {},
+	"gcflags":       {},
+	"dotfile":       {},
+	"tags":          {},
+	"race":          {},
+	"cache":         {},
+	"vet":           {boolVar: true},
+	"allowinternal": {boolVar: true},
+	"strict":        {boolVar: true},
+	"gopath":        {boolVar: true},
 
 	// Passed to the test binary
 	"q":                {boolVar: true, passToTest: true},
@@ -122,6 +122,18 @@ func TestTestFlagsPreParse(t *testing.T) {
 			args:  []string{"-race", "-name=jardin"},
 			pargs: []string{"-race"},
 			eargs: []string{"-name=jardin"},
+		}, {
+			args:  []string{"-allowinternal", "-short"},
+			pargs: []string{"-allowinternal"},
+			eargs: []string{"-short"},
+		}, {
+			args:  []string{"-strict", "-short"},
+			pargs: []string{"-strict"},
+			eargs: []string{"-short"},
+		}, {
+			args:  []string{"-gopath", "-short"},
+			pargs: []string{"-gopath"},
+			eargs: []string{"-short"},
 		}}
 
 	for _, tt := range tests {
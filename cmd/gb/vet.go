@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"sort"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/test"
+	"github.com/constabulary/gb/vet"
+)
+
+func init() {
+	registerCommand(vetCmd)
+}
+
+var vetCmd = &cmd.Command{
+	Name:      "vet",
+	UsageLine: "vet [build flags] [packages]",
+	Short:     "report likely mistakes in packages",
+	Long: `
+Vet type checks the packages named by the import paths, along with their
+tests, and reports suspicious constructs, such as Printf calls whose
+arguments do not align with the format string.
+
+Packages are loaded in the same way as 'gb build', so imports are resolved
+from $PROJECT/src, $PROJECT/vendor/src, the depfile cache and $GOROOT.
+Problems are reported relative to the project root, and vet exits with a
+non zero status if any are found.
+
+The checks performed are:
+
+	assign        useless assignments, x = x
+	atomic        x = atomic.AddInt64(&x, 1)
+	composites    unkeyed composite literals of imported struct types
+	copylocks     locks, such as sync.Mutex, passed or copied by value
+	nilfunc       comparisons between functions and nil
+	printf        Printf format strings which do not match their arguments
+	structtag     malformed struct field tags and duplicate json or xml names
+	unreachable   unreachable code
+	unusedresult  unused results of calls to functions such as fmt.Sprintf
+
+The build flags are shared by the build and test commands. For more
+information, run 'gb help build'.
+
+See also: gb test -vet.
+`,
+	Run: func(ctx *gb.Context, args []string) error {
+		sort.Strings(args)
+		pkgs, err := resolveRootPackages(test.TestResolver(ctx), args...)
+		if err != nil {
+			return err
+		}
+
+		vet, err := vet.VetPackages(pkgs...)
+		if err != nil {
+			return err
+		}
+
+		if dotfile != "" {
+			f, err := os.Create(dotfile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			printActions(f, vet)
+		}
+
+		startSigHandlers()
+		return gb.ExecuteConcurrent(vet, P, interrupted)
+	},
+	AddFlags: addBuildFlags,
+}
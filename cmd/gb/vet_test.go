@@ -0,0 +1,52 @@
+package main_test
+
+import "testing"
+
+func TestVet(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/a.go", `package a
+
+import "fmt"
+
+func A(s string) {
+	fmt.Printf("%d\n", s)
+}
+`)
+	gb.tempFile("src/b/b.go", "package b\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("vet")
+	gb.grepStderr(`^src/a/a.go:6:2: Printf format %d has arg s of wrong type string$`, "expected project relative printf diagnostic")
+	gb.grepStderr(`vet: a: 1 issue\(s\) found`, "expected vet failure")
+}
+
+func TestVetVendor(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("vendor/src/v/v.go", "package v\n\ntype Point struct{ X, Y int }\n")
+	gb.tempFile("src/a/a.go", `package a
+
+import "v"
+
+var P = v.Point{X: 1, Y: 2}
+`)
+	gb.cd(gb.tempdir)
+	gb.run("vet", "a")
+	gb.grepStderrNot(".", "expected no diagnostics")
+}
+
+func TestTestVet(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	gb.tempFile("src/a/a.go", `package a
+
+func A(x int) int {
+	x = x
+	return x
+}
+`)
+	gb.tempFile("src/a/a_test.go", "package a\n")
+	gb.cd(gb.tempdir)
+	gb.runFail("test", "-vet", "a")
+	gb.grepStderr(`^src/a/a.go:4:2: self-assignment of x to x$`, "expected assign diagnostic")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/cmd"
+	"github.com/constabulary/gb/cmd/gb/internal/match"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&cmd.Command{
+		Name:      "why",
+		UsageLine: "why importpath [packages]",
+		Short:     "explain why a package is in the build",
+		Long: `
+Why prints the shortest import chain from each of the packages named by the
+import paths to the package importpath, one package per line, followed by a
+blank line. If no packages are named, all packages in $PROJECT/src are used.
+
+A chain is not printed if it passes through another named package, as
+that package's own chain already explains it.
+
+If a package only depends on importpath through the imports of its tests,
+the chain starts with the package followed by "(test)".
+
+Why exits with a non zero status if none of the packages import importpath.
+`,
+		Run:           why,
+		SkipParseArgs: true,
+	})
+}
+
+func why(ctx *gb.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("no import path supplied")
+	}
+	target, args := args[0], args[1:]
+
+	srcdir := filepath.Join(ctx.Projectdir(), "src")
+	cwd := cmd.MustGetwd()
+	for _, a := range args {
+		if a == "all" {
+			args = nil
+			break
+		}
+	}
+	if len(args) == 0 {
+		args = []string{"..."}
+		cwd = srcdir
+	}
+	pkgs, err := resolveRootPackages(ctx, match.ImportPaths(srcdir, cwd, args)...)
+	if err != nil {
+		return err
+	}
+
+	chains := whyChains(ctx, func(pkg *gb.Package) bool {
+		// packages vendored by the standard library are recorded
+		// with a vendor/ prefix.
+		return pkg.ImportPath == target || pkg.ImportPath == "vendor/"+target
+	}, pkgs)
+	if len(chains) == 0 {
+		return errors.Errorf("%s is not imported by the named packages", target)
+	}
+	printChains(chains)
+	return nil
+}
+
+// printChains prints each chain, one package per line, followed by a blank
+// line.
+func printChains(chains []chain) {
+	for _, c := range chains {
+		for i, pkg := range c.pkgs {
+			if i == 0 && c.test {
+				fmt.Printf("%s (test)\n", pkg.ImportPath)
+				continue
+			}
+			fmt.Println(pkg.ImportPath)
+		}
+		fmt.Println()
+	}
+}
+
+// chain is an import chain from a root package to the target.
+type chain struct {
+	pkgs []*gb.Package
+	test bool // the first import is a test import
+}
+
+// whyChains returns the shortest chain from each root to a package
+// matching target, omitting chains which pass through another root. A root
+// whose test imports cannot be resolved is skipped with a warning.
+func whyChains(ctx *gb.Context, target func(*gb.Package) bool, roots []*gb.Package) []chain {
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		isRoot[root.ImportPath] = true
+	}
+
+	var chains []chain
+next:
+	for _, root := range roots {
+		c := chain{pkgs: shortestChain(root, root.Imports, target)}
+		if c.pkgs == nil {
+			imports, err := testImports(ctx, root)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: skipping %s: %v\n", root.ImportPath, err)
+				continue
+			}
+			c = chain{pkgs: shortestChain(root, imports, target), test: true}
+		}
+		if c.pkgs == nil {
+			continue
+		}
+		for i := 1; i < len(c.pkgs)-1; i++ {
+			if isRoot[c.pkgs[i].ImportPath] {
+				continue next
+			}
+		}
+		chains = append(chains, c)
+	}
+	return chains
+}
+
+// shortestChain returns the shortest chain of imports from root, whose
+// direct imports are first, to a package matching target, or nil if there
+// is none.
+func shortestChain(root *gb.Package, first []*gb.Package, target func(*gb.Package) bool) []*gb.Package {
+	if target(root) {
+		return []*gb.Package{root}
+	}
+
+	parent := map[string]*gb.Package{root.ImportPath: nil}
+	var queue []*gb.Package
+	for _, pkg := range first {
+		if _, ok := parent[pkg.ImportPath]; ok || pkg.ImportPath == "C" {
+			continue
+		}
+		parent[pkg.ImportPath] = root
+		queue = append(queue, pkg)
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if target(pkg) {
+			var c []*gb.Package
+			for p := pkg; p != nil; p = parent[p.ImportPath] {
+				c = append([]*gb.Package{p}, c...)
+			}
+			return c
+		}
+		for _, dep := range pkg.Imports {
+			if _, ok := parent[dep.ImportPath]; ok || dep.ImportPath == "C" {
+				continue
+			}
+			parent[dep.ImportPath] = pkg
+			queue = append(queue, dep)
+		}
+	}
+	return nil
+}
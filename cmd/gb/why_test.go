@@ -0,0 +1,61 @@
+package main_test
+
+import "testing"
+
+func mkwhyfixture(gb *T) {
+	gb.tempFile("src/a/a.go", "package a\n\nimport \"b\"\n\nvar A = b.B\n")
+	gb.tempFile("src/b/b.go", "package b\n\nimport \"heavy\"\n\nvar B = heavy.H\n")
+	gb.tempFile("src/c/c.go", "package c\n\nimport \"a\"\n\nvar C = a.A\n")
+	gb.tempFile("src/t/t.go", "package t\n")
+	gb.tempFile("src/t/t_test.go", "package t\n\nimport (\n\t\"testing\"\n\n\t\"heavy\"\n)\n\nfunc TestT(t *testing.T) { _ = heavy.H }\n")
+	gb.tempFile("src/u/u.go", "package u\n")
+	gb.tempFile("vendor/src/heavy/heavy.go", "package heavy\n\nconst H = 1\n")
+}
+
+func TestWhy(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkwhyfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("why", "heavy")
+	want := "b\nheavy\n\nt (test)\nheavy\n\n"
+	if got := gb.stdout.String(); got != want {
+		t.Fatalf("gb why heavy: got %q, want %q", got, want)
+	}
+}
+
+func TestWhyFrom(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkwhyfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.run("why", "heavy", "c")
+	want := "c\na\nb\nheavy\n\n"
+	if got := gb.stdout.String(); got != want {
+		t.Fatalf("gb why heavy c: got %q, want %q", got, want)
+	}
+}
+
+func TestWhyNotImported(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkwhyfixture(&gb)
+	gb.cd(gb.tempdir)
+	gb.runFail("why", "heavy", "u")
+	gb.grepStderr(`heavy is not imported by the named packages`, "expected not imported error")
+}
+
+func TestWhySkipsUnresolvedTestImports(t *testing.T) {
+	gb := T{T: t}
+	defer gb.cleanup()
+	mkwhyfixture(&gb)
+	gb.tempFile("src/v/v.go", "package v\n")
+	gb.tempFile("src/v/v_test.go", "package v\n\nimport (\n\t\"testing\"\n\n\t\"missing\"\n)\n\nfunc TestV(t *testing.T) { _ = missing.M }\n")
+	gb.cd(gb.tempdir)
+	gb.run("why", "heavy")
+	want := "b\nheavy\n\nt (test)\nheavy\n\n"
+	if got := gb.stdout.String(); got != want {
+		t.Fatalf("gb why heavy: got %q, want %q", got, want)
+	}
+	gb.grepStderr(`^warning: skipping v: failed to resolve import path "missing"`, "expected warning for v")
+}
@@ -8,11 +8,13 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	pathpkg "path"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -41,6 +43,8 @@ type Context struct {
 
 	tc Toolchain
 
+	cache Cache // remote build cache, if any
+
 	gohostos, gohostarch     string // GOOS and GOARCH for this host
 	gotargetos, gotargetarch string // GOOS and GOARCH for the target
 
@@ -59,6 +63,32 @@ type Context struct {
 
 	buildtags []string // build tags
 
+	allowInternal bool // do not enforce the visibility of internal packages
+	strict        bool // fail if an import path is provided by more than one root
+
+	gopath      bool     // fall back to $GOPATH for packages not in the project
+	gopathRoots []string // $GOPATH entries searched, if gopath is set
+
+	depfileModules map[string]string // module versions required by the depfile
+	modules        []module          // modules served from the module cache
+
+	skipDepfile  bool                         // do not read the depfile or fetch its entries
+	ignoreLock   bool                         // do not verify depfile content against depfile.lock
+	depfileSums  map[string]map[string]string // depfile.lock entries for the fetched depfile content
+	depfileNodes []*depNode                   // content of the depfile entries in use, excluding overrides
+
+	overrides []override // depfile entries replaced by local directories
+
+	fetchJobs int // depfile entries fetched at once
+
+	updateDepfile  bool            // resolve depfile version constraints again
+	updatePrefixes map[string]bool // depfile entries to update, all if empty
+
+	roots []sourceRoot // source roots searched by the importer
+
+	outfile, outdir string             // -o file or -o dir/ destination for binaries
+	bintemplate     *template.Template // template for binary names, if any
+
 	debug func(string, ...interface{})
 }
 
@@ -108,6 +138,59 @@ func Ldflags(flags ...string) func(*Context) error {
 	}
 }
 
+// Output configures the Context to write linked binaries to path. If path
+// ends in a path separator, or names an existing directory, binaries are
+// written into that directory, otherwise path is the name of the binary
+// and only a single main package may be built.
+func Output(path string) func(*Context) error {
+	return func(c *Context) error {
+		if path == "" {
+			return errors.New("output path cannot be blank")
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(abs); (err == nil && fi.IsDir()) || os.IsPathSeparator(path[len(path)-1]) {
+			c.outdir = abs
+			return nil
+		}
+		c.outfile = abs
+		return nil
+	}
+}
+
+// BinName configures the Context to name linked binaries by executing the
+// text/template tmpl against a BinNameData value.
+func BinName(tmpl string) func(*Context) error {
+	return func(c *Context) error {
+		t, err := template.New("binname").Parse(tmpl)
+		if err != nil {
+			return errors.Wrap(err, "invalid binary name template")
+		}
+		// catch references to unknown fields now, rather than during the link.
+		if err := t.Execute(ioutil.Discard, BinNameData{}); err != nil {
+			return errors.Wrap(err, "invalid binary name template")
+		}
+		c.bintemplate = t
+		return nil
+	}
+}
+
+// BinNameData is the data available to the template supplied to BinName.
+type BinNameData struct {
+	Name       string // base of the import path, the default binary name
+	ImportPath string // import path of the main package
+	GOOS       string // target operating system
+	GOARCH     string // target architecture
+	Tags       string // build tags, joined by "-"
+	Ext        string // ".exe" on windows, otherwise empty
+}
+
+// OutputFile returns the path supplied to Output, if it names a
+// single binary rather than a directory.
+func (c *Context) OutputFile() string { return c.outfile }
+
 func WithDebug(w io.Writer) func(*Context) error {
 	return func(c *Context) error {
 		l := log.New(w, "", log.Ldate|log.Ltime|log.Lshortfile)
@@ -128,6 +211,21 @@ func WithRace(c *Context) error {
 	return nil
 }
 
+// AllowInternal disables the check that packages inside an internal
+// directory are only imported by packages rooted at the parent of that
+// directory. It is intended for legacy code which predates the rule.
+func AllowInternal(c *Context) error {
+	c.allowInternal = true
+	return nil
+}
+
+// Strict causes resolution of an import to fail if its import path is
+// provided by more than one source root, as only one of them will be used.
+func Strict(c *Context) error {
+	c.strict = true
+	return nil
+}
+
 // NewContext returns a new build context from this project.
 // By default this context will use the gc toolchain with the
 // host's GOOS and GOARCH values.
@@ -147,6 +245,7 @@ func NewContext(p Project, opts ...func(*Context) error) (*Context, error) {
 			c.gotargetos = envOr("GOOS", runtime.GOOS)
 			c.gotargetarch = envOr("GOARCH", runtime.GOARCH)
 			c.debug = func(string, ...interface{}) {} // null logger
+			c.fetchJobs = runtime.NumCPU()
 			return nil
 		},
 		GcToolchain(),
@@ -273,6 +372,9 @@ func (c *Context) loadPackage(stack []string, path string) (*Package, error) {
 	stack = append(stack, p.ImportPath)
 	var stale bool
 	for i, im := range p.Imports {
+		if path := c.nestedVendor(p, im); path != "" {
+			im = path
+		}
 		for _, p := range stack {
 			if p == im {
 				return nil, fmt.Errorf("import cycle detected: %s", strings.Join(append(stack, im), " -> "))
@@ -282,6 +384,12 @@ func (c *Context) loadPackage(stack []string, path string) (*Package, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := c.checkShadowed(p, im); err != nil {
+			return nil, err
+		}
+		if err := c.checkInternal(p, pkg); err != nil {
+			return nil, err
+		}
 
 		// update the import path as the import may have been discovered via vendoring.
 		p.Imports[i] = pkg.ImportPath
@@ -298,6 +406,165 @@ func (c *Context) loadPackage(stack []string, path string) (*Package, error) {
 	return pkg, nil
 }
 
+// nestedVendor returns the import path of the copy of path found in a vendor
+// directory nested inside the source tree of p, searching from the directory
+// of p upwards, or "" if there is none. Imports of packages in $PROJECT/src,
+// modules and the standard library are resolved as before.
+func (c *Context) nestedVendor(p *build.Package, path string) string {
+	if !c.hasNestedVendor(p) || path == "C" {
+		return ""
+	}
+	for dir := p.Dir; strings.HasPrefix(dir, p.SrcRoot+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == "vendor" {
+			continue
+		}
+		vdir := filepath.Join(dir, "vendor", filepath.FromSlash(path))
+		if fi, err := os.Stat(vdir); err != nil || !fi.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(p.SrcRoot, vdir)
+		if err != nil {
+			return ""
+		}
+		return filepath.ToSlash(rel)
+	}
+	return ""
+}
+
+// hasNestedVendor reports whether the imports of p are resolved from vendor
+// directories nested inside its source tree.
+func (c *Context) hasNestedVendor(p *build.Package) bool {
+	// modules ignore the vendor directories of their dependencies, and
+	// overrides are not laid out below a src directory.
+	return !(p.Goroot || p.Root == "" || p.Root == c.Projectdir() || c.isModuleRoot(p.Root) || c.isOverrideRoot(p.Root))
+}
+
+// nestedVendorImports returns the imports of pkg which were resolved from a
+// vendor directory nested inside its source tree by nestedVendor.
+func (pkg *Package) nestedVendorImports() []string {
+	if !pkg.hasNestedVendor(pkg.Package) {
+		return nil
+	}
+	var paths []string
+	for _, path := range pkg.Package.Imports {
+		i := strings.LastIndex(path, "/vendor/")
+		if i < 0 {
+			continue
+		}
+		// nestedVendor only searches the directory of pkg and its parents.
+		if parent := path[:i]; pkg.ImportPath == parent || strings.HasPrefix(pkg.ImportPath, parent+"/") {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// A sourceRoot is a directory providing the packages whose import paths
+// begin with prefix. A GOPATH style root, such as $PROJECT, has an empty
+// prefix and dir is its src directory.
+type sourceRoot struct {
+	prefix string
+	dir    string // the directory holding the package prefix
+}
+
+// lookup returns the directory of the import path within r, or "" if path
+// does not begin with the prefix of r.
+func (r sourceRoot) lookup(path string) string {
+	switch {
+	case r.prefix == "":
+		return filepath.Join(r.dir, filepath.FromSlash(path))
+	case path == r.prefix:
+		return r.dir
+	case strings.HasPrefix(path, r.prefix+"/"):
+		return filepath.Join(r.dir, filepath.FromSlash(path[len(r.prefix)+1:]))
+	default:
+		return ""
+	}
+}
+
+type byRootDir []sourceRoot
+
+func (r byRootDir) Len() int           { return len(r) }
+func (r byRootDir) Less(i, j int) bool { return r[i].dir < r[j].dir }
+func (r byRootDir) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// Shadows returns the directories which provide the import path in each of
+// the source roots known to the Context; GOROOT, $PROJECT/src,
+// $PROJECT/vendor/src, $GOPATH if enabled, the depfile cache, required
+// modules, then depfile overrides. If more than one directory is returned
+// the import path is shadowed, as only one of them can be used.
+func (c *Context) Shadows(path string) []string {
+	goroot := filepath.Join(runtime.GOROOT(), "src")
+	var dirs []string
+	for _, root := range c.roots {
+		candidates := []string{path}
+		if root.dir == goroot {
+			// the GOROOT importer searches the standard library's
+			// vendor directory first.
+			candidates = []string{pathpkg.Join("vendor", path), path}
+		}
+		for _, path := range candidates {
+			dir := root.lookup(path)
+			if dir == "" {
+				continue
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(files) > 0 {
+				dirs = append(dirs, dir)
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// checkShadowed returns an error, if the Context is strict, when the import
+// path im of p is provided by more than one source root. Imports by standard
+// library packages are not checked.
+func (c *Context) checkShadowed(p *build.Package, im string) error {
+	if !c.strict || p.Goroot || im == "C" {
+		return nil
+	}
+	if dirs := c.Shadows(im); len(dirs) > 1 {
+		return errors.Errorf("%s imports %s, which is provided by more than one root: %s", p.ImportPath, im, strings.Join(dirs, ", "))
+	}
+	return nil
+}
+
+// checkInternal returns an error if p may not import pkg because pkg is
+// inside an internal directory whose parent does not contain p. Imports by
+// standard library packages are not checked.
+func (c *Context) checkInternal(p *build.Package, pkg *Package) error {
+	if c.allowInternal || p.Goroot {
+		return nil
+	}
+	i := internalIndex(pkg.ImportPath)
+	if i < 0 {
+		return nil
+	}
+	// the rule applies to directories, as packages with the same import
+	// path prefix may live in different source roots.
+	parent := strings.TrimSuffix(pkg.Dir, filepath.FromSlash(pkg.ImportPath[i:]))
+	if strings.HasPrefix(p.Dir+string(filepath.Separator), parent) {
+		return nil
+	}
+	return errors.Errorf("%s imports %s: use of internal package not allowed", p.ImportPath, pkg.ImportPath)
+}
+
+// internalIndex returns the index of the final "internal" element of the
+// import path, or -1 if there is none.
+func internalIndex(path string) int {
+	switch {
+	case strings.Contains(path, "/internal/"):
+		return strings.LastIndex(path, "/internal/") + 1
+	case strings.HasSuffix(path, "/internal"):
+		return len(path) - len("internal")
+	case path == "internal" || strings.HasPrefix(path, "internal/"):
+		return 0
+	default:
+		return -1
+	}
+}
+
 // Destroy removes the temporary working files of this context.
 func (c *Context) Destroy() error {
 	c.debug("removing work directory: %v", c.workdir)
@@ -433,10 +700,40 @@ func cgoEnabled(gohostos, gohostarch, gotargetos, gotargetarch string) bool {
 }
 
 func buildImporter(bc *build.Context, ctx *Context) (Importer, error) {
-	i, err := addDepfileDeps(bc, ctx)
-	if err != nil {
-		return nil, err
+	i := Importer(new(nullImporter))
+	if ctx.skipDepfile {
+		ctx.debug("skipping depfile")
+	} else {
+		var err error
+		i, err = addDepfileDeps(bc, ctx)
+		if err != nil {
+			return nil, err
+		}
+		i, err = addModuleDeps(bc, ctx, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ctx.gopath {
+		i = addGopathDeps(bc, ctx, i)
+	}
+	sort.Sort(byRootDir(ctx.roots))
+	roots := []sourceRoot{
+		{dir: filepath.Join(runtime.GOROOT(), "src")},
+		{dir: filepath.Join(ctx.Projectdir(), "src")},
+		{dir: filepath.Join(ctx.Projectdir(), "vendor", "src")},
+	}
+	for _, root := range ctx.gopathRoots {
+		roots = append(roots, sourceRoot{dir: filepath.Join(root, "src")})
+	}
+	roots = append(roots, ctx.roots...)
+	for _, m := range ctx.modules {
+		roots = append(roots, sourceRoot{prefix: m.path, dir: m.dir})
+	}
+	for _, o := range ctx.overrides {
+		roots = append(roots, sourceRoot{prefix: o.prefix, dir: o.dir})
 	}
+	ctx.roots = roots
 
 	// construct importer stack in reverse order, vendor at the bottom, GOROOT on the top.
 	i = &_importer{
@@ -192,6 +192,138 @@ func TestContextLoadPackage(t *testing.T) {
 	}
 }
 
+func TestContextNestedVendor(t *testing.T) {
+	ctx := testContext(t)
+	defer ctx.Destroy()
+	pkg, err := ctx.loadPackage(nil, "usesnestedlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, dep := range pkg.Imports {
+		got = append(got, dep.ImportPath)
+		for _, dep := range dep.Imports {
+			got = append(got, dep.ImportPath)
+		}
+	}
+	// project packages are not affected by nested vendor directories,
+	// nestedlib uses its own copy of nesteddep.
+	want := []string{"nesteddep", "nestedlib", "nestedlib/vendor/nesteddep"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loadPackage(%q): got imports %v, want %v", "usesnestedlib", got, want)
+	}
+
+	// only the imports resolved from a nested vendor directory are
+	// mapped by the compiler.
+	if got := pkg.nestedVendorImports(); got != nil {
+		t.Errorf("nestedVendorImports(%q): got %v, want none", pkg.ImportPath, got)
+	}
+	lib := pkg.Imports[1]
+	want = []string{"nestedlib/vendor/nesteddep"}
+	if got := lib.nestedVendorImports(); !reflect.DeepEqual(got, want) {
+		t.Errorf("nestedVendorImports(%q): got %v, want %v", lib.ImportPath, got, want)
+	}
+}
+
+func TestContextShadows(t *testing.T) {
+	ctx := testContext(t)
+	defer ctx.Destroy()
+	root := ctx.Projectdir()
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"a", []string{filepath.Join(root, "src", "a")}},
+		{"nesteddep", []string{filepath.Join(root, "vendor", "src", "nesteddep")}},
+		{"shadowed", []string{filepath.Join(root, "src", "shadowed"), filepath.Join(root, "vendor", "src", "shadowed")}},
+		{"fmt", []string{filepath.Join(runtime.GOROOT(), "src", "fmt")}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ctx.Shadows(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Shadows(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestContextStrict(t *testing.T) {
+	tests := []struct {
+		opts []func(*Context) error
+		path string
+		err  bool
+	}{
+		{path: "usesshadowed"},
+		{path: "usesshadowed", opts: []func(*Context) error{Strict}, err: true},
+		{path: "usesnestedlib", opts: []func(*Context) error{Strict}},
+		{path: "net/http", opts: []func(*Context) error{Strict}},
+	}
+
+	proj := testProject(t)
+	for _, tt := range tests {
+		ctx, err := NewContext(proj, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		_, err = ctx.loadPackage(nil, tt.path)
+		if (err != nil) != tt.err {
+			t.Errorf("loadPackage(%q): got error %v, want error: %v", tt.path, err, tt.err)
+		}
+	}
+}
+
+func TestContextInternalImports(t *testing.T) {
+	tests := []struct {
+		opts []func(*Context) error
+		path string
+		err  string
+	}{
+		{path: "internals/a"},
+		{path: "internals/internal/x"},
+		{path: "internalbad", err: "internalbad imports internals/internal/x: use of internal package not allowed"},
+		{path: "internalbad", opts: []func(*Context) error{AllowInternal}},
+		{path: "net/http"}, // imports internal and vendored internal packages
+	}
+
+	proj := testProject(t)
+	for _, tt := range tests {
+		ctx, err := NewContext(proj, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		_, err = ctx.loadPackage(nil, tt.path)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("loadPackage(%q): %v", tt.path, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("loadPackage(%q): got %v, want %q", tt.path, err, tt.err)
+		}
+	}
+}
+
+func TestInternalIndex(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"a/b", -1},
+		{"internal", 0},
+		{"internal/a", 0},
+		{"a/internal", 2},
+		{"a/internal/b", 2},
+		{"a/internal/b/internal/c", 13},
+		{"a/internalfoo/b", -1},
+	}
+
+	for _, tt := range tests {
+		if got := internalIndex(tt.path); got != tt.want {
+			t.Errorf("internalIndex(%q): got %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
 func TestCgoEnabled(t *testing.T) {
 	tests := []struct {
 		gohostos, gohostarch     string
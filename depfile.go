@@ -1,6 +1,7 @@
 package gb
 
 import (
+	"archive/zip"
 	"compress/gzip"
 	"crypto/sha1"
 	"fmt"
@@ -8,17 +9,30 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/constabulary/gb/internal/depfile"
+	"github.com/constabulary/gb/internal/fileutils"
 	"github.com/constabulary/gb/internal/untar"
+	"github.com/constabulary/gb/internal/vendor"
 	"github.com/pkg/errors"
 )
 
-const semverRegex = `^([0-9]+)\.([0-9]+)\.([0-9]+)(?:(\-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-\-\.]+)?$`
+// semverRegex matches a SemVer 2.0.0 version.
+var semverRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)(?:(\-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-\-\.]+)?$`)
+
+// SkipDepfile configures the Context not to read the depfile or go.mod, nor
+// fetch their entries, so commands which edit the depfile or manage the
+// cache work when an entry cannot be fetched.
+func SkipDepfile(c *Context) error {
+	c.skipDepfile = true
+	return nil
+}
 
 // addDepfileDeps inserts into the Context's importer list
 // a set of importers for entries in the depfile.
@@ -30,106 +44,366 @@ func addDepfileDeps(bc *build.Context, ctx *Context) (Importer, error) {
 			return nil, errors.Wrap(err, "could not parse depfile")
 		}
 		ctx.debug("no depfile, nothing to do.")
-		return i, nil
 	}
-	re := regexp.MustCompile(semverRegex)
-	for prefix, kv := range df {
-		if version, ok := kv["version"]; ok {
-			if !re.MatchString(version) {
-				return nil, errors.Errorf("%s: %q is not a valid SemVer 2.0.0 version", prefix, version)
-			}
-			root := filepath.Join(cachePath(), hash(prefix, version))
-			dest := filepath.Join(root, "src", filepath.FromSlash(prefix))
-			fi, err := os.Stat(dest)
-			if err == nil {
-				if !fi.IsDir() {
-					return nil, errors.Errorf("%s is not a directory", dest)
-				}
-			}
-			if err != nil {
-				if !os.IsNotExist(err) {
-					return nil, err
-				}
-				if err := fetchVersion(root, dest, prefix, version); err != nil {
-					return nil, err
-				}
+	ctx.overrides, err = readOverrides(ctx, df)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readDepfileLock(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse depfile.lock")
+	}
+	index, err := readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+	var reqs []*requirement
+	for _, prefix := range sortedPrefixes(df) {
+		kv := df[prefix]
+		if version, ok := kv["module"]; ok {
+			// served from the module cache by addModuleDeps.
+			if !strings.HasPrefix(version, "v") {
+				return nil, errors.Errorf("%s: module version %q must start with v", prefix, version)
 			}
-			i = &_importer{
-				Importer: i,
-				im: importer{
-					Context: bc,
-					Root:    root,
-				},
+			if ctx.depfileModules == nil {
+				ctx.depfileModules = make(map[string]string)
 			}
-			ctx.debug("add importer for %q: %v", prefix+" "+version, root)
+			ctx.depfileModules[prefix] = version
+			continue
 		}
+		reqs = append(reqs, &requirement{prefix: prefix, kv: kv, by: "depfile"})
+	}
 
-		if tag, ok := kv["tag"]; ok {
-			root := filepath.Join(cachePath(), hash(prefix, tag))
-			dest := filepath.Join(root, "src", filepath.FromSlash(prefix))
-			fi, err := os.Stat(dest)
-			if err == nil {
-				if !fi.IsDir() {
-					return nil, errors.Errorf("%s is not a directory", dest)
-				}
-			}
-			if err != nil {
-				if !os.IsNotExist(err) {
-					return nil, err
-				}
-				if err := fetchTag(root, dest, prefix, tag); err != nil {
-					return nil, err
-				}
-			}
-			i = &_importer{
-				Importer: i,
-				im: importer{
-					Context: bc,
-					Root:    root,
-				},
+	g, err := loadDepGraph(ctx, reqs, lock)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := g.selectVersions()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range selected {
+		if n.override {
+			// served by the override importer.
+			continue
+		}
+		locked := lock[n.prefix]
+		switch {
+		case ctx.ignoreLock:
+			locked = nil
+		case lock != nil && locked == nil:
+			return nil, errors.Errorf("no entry for %s in depfile.lock; run gb depfile lock", n.prefix)
+		}
+		want, err := expectedSum(n.prefix, n.entry, locked)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := treeHash(n.dest)
+		if err != nil {
+			return nil, err
+		}
+		if want != "" && sum != want {
+			if n.fetched {
+				os.RemoveAll(n.root)
+				return nil, errors.Errorf("%s: downloaded content has sha256 %s, expected %s", n.prefix, sum, want)
 			}
-			ctx.debug("add importer for %q: %v", prefix+" "+tag, root)
+			return nil, errors.Errorf("%s: cached content in %s has sha256 %s, expected %s; remove it to fetch again", n.prefix, n.root, sum, want)
+		}
+		if fetched := index[filepath.Base(n.root)]["sha256"]; want == "" && !n.fetched && fetched != "" && sum != fetched {
+			// without a lock, cached content is trusted only if it
+			// has not changed since it was fetched.
+			return nil, errors.Errorf("%s: cached content in %s has sha256 %s, but had %s when fetched; remove it to fetch again", n.prefix, n.root, sum, fetched)
+		}
+		ctx.lockDepfile(n.prefix, n.entry, sum)
+		n.sum = sum
+		ctx.depfileNodes = append(ctx.depfileNodes, n)
+
+		i = &_importer{
+			Importer: i,
+			im: importer{
+				Context: bc,
+				Root:    n.root,
+			},
+		}
+		ctx.roots = append(ctx.roots, sourceRoot{dir: filepath.Join(n.root, "src")})
+		ctx.debug("add importer for %q: %v", n.prefix+" "+n.src.desc, n.root)
+	}
+	if len(ctx.depfileNodes) > 0 {
+		if err := indexDepfileCache(ctx.depfileNodes); err != nil {
+			// the index only describes the cache, builds do not need it.
+			ctx.debug("could not update cache index: %v", err)
+		}
+	}
+	if len(ctx.overrides) > 0 {
+		i = &overrideImporter{
+			Importer:  i,
+			Context:   bc,
+			overrides: ctx.overrides,
+		}
+	}
+	for prefix := range ctx.updatePrefixes {
+		if _, ok := g.reqs[prefix]; !ok {
+			return nil, errors.Errorf("%s is not in the depfile", prefix)
 		}
 	}
 	return i, nil
 }
 
-func fetchVersion(root, dest, prefix, version string) error {
-	if !strings.HasPrefix(prefix, "github.com") {
-		return errors.Errorf("unable to fetch %v", prefix)
+// fetchDep fetches the depfile entry kv for prefix, unless it is present in
+// the cache, returning the source of the entry, the cache root holding it,
+// and whether it was fetched.
+func fetchDep(prefix string, kv map[string]string) (*depSource, string, bool, error) {
+	src, err := depfileSource(prefix, kv)
+	if err != nil || src == nil {
+		return nil, "", false, err
+	}
+	root := filepath.Join(cachePath(), hash(prefix, src.key...))
+	dest := filepath.Join(root, "src", filepath.FromSlash(prefix))
+	fi, err := os.Stat(dest)
+	switch {
+	case err == nil && !fi.IsDir():
+		return nil, "", false, errors.Errorf("%s is not a directory", dest)
+	case err == nil:
+		return src, root, false, nil
+	case !os.IsNotExist(err):
+		return nil, "", false, err
 	}
 
-	fmt.Printf("fetching %v (%v)\n", prefix, version)
-
-	rc, err := fetchRelease(prefix, "v"+version)
+	// another gb process may be fetching the same content into the cache.
+	if err := os.MkdirAll(cachePath(), 0755); err != nil {
+		return nil, "", false, err
+	}
+	unlock, err := fileutils.Lock(root + ".lock")
 	if err != nil {
-		return err
+		return nil, "", false, err
 	}
-	defer rc.Close()
-	return unpackReleaseTarball(dest, rc)
+	defer unlock()
+	if _, err := os.Stat(dest); err == nil {
+		// fetched while waiting for the lock.
+		return src, root, false, nil
+	}
+
+	start := time.Now()
+	d := download{prefix: prefix}
+	var mirrored bool
+	if m := mirror(); m != "" {
+		fetchProgress.printf("fetching %v (%v) from %v\n", prefix, src.desc, m)
+		mirrored, err = fetchMirror(m, root, dest, &d)
+		if err != nil {
+			return nil, "", false, errors.Wrapf(err, "unable to fetch %v from mirror", prefix)
+		}
+	}
+	if !mirrored {
+		if vendor.Offline() && !src.local {
+			return nil, "", false, errors.Errorf("%v (%v) is not in %v or GB_MIRROR, and network access is disabled by GB_OFFLINE; run gb depfile download on a machine with network access and set GB_MIRROR to the directory it writes", prefix, src.desc, cachePath())
+		}
+		fetchProgress.printf("fetching %v (%v)\n", prefix, src.desc)
+		if err := src.fetch(dest, &d); err != nil {
+			return nil, "", false, errors.Wrapf(err, "unable to fetch %v", prefix)
+		}
+	}
+	if d.n > 0 {
+		fetchProgress.printf("fetched %v (%v), %s in %v\n", prefix, src.desc, FormatSize(d.n), time.Since(start)/time.Millisecond*time.Millisecond)
+	}
+	return src, root, true, nil
 }
 
-func fetchTag(root, dest, prefix, tag string) error {
-	if !strings.HasPrefix(prefix, "github.com") {
-		return errors.Errorf("unable to fetch %v", prefix)
+// A depSource fetches the contents of a depfile entry.
+type depSource struct {
+	// key identifies the contents of prefix in the cache. hash does not
+	// separate its components, so they are labelled.
+	key   []string
+	desc  string // describes the source to the user
+	fetch func(dest string, d *download) error
+	local bool // fetch does not access the network
+}
+
+// depfileSource returns the source of the depfile entry for prefix, or nil
+// if the entry does not name one. The forms understood are
+//
+//	prefix version=1.2.3 [forge=name]	release v1.2.3 of the repository
+//	prefix version=^1.2.0 [forge=name]	the highest release matching the constraint
+//	prefix tag=name [forge=name]		the tag of the repository
+//	prefix url=https://host/file.tar.gz	a tar.gz or zip archive
+//	prefix vcs=git repo=url [tag=name | revision=rev | branch=name]
+//
+// The archive of a version or tag is fetched from the forge hosting the
+// repository, which is inferred from the host of prefix if not supplied; one
+// of github, gitlab, bitbucket or gitea. For url and forge archives, a single
+// top level directory in the archive is removed. The vcs form checks out the
+// repository, which may be git or hg, using the same code as gb vendor.
+func depfileSource(prefix string, kv map[string]string) (*depSource, error) {
+	switch {
+	case kv["vcs"] != "":
+		return vcsSource(prefix, kv)
+	case kv["url"] != "":
+		url := kv["url"]
+		return &depSource{
+			key:   []string{url},
+			desc:  url,
+			fetch: func(dest string, d *download) error { return fetchArchive(dest, url, d) },
+		}, nil
+	case kv["version"] != "":
+		version := kv["version"]
+		if !isVersion(version) {
+			return nil, errors.Errorf("%s: %q is not a valid SemVer 2.0.0 version", prefix, version)
+		}
+		url, err := archiveURL(prefix, kv["forge"], "v"+version)
+		if err != nil {
+			return nil, err
+		}
+		return &depSource{
+			key:   forgeKey(version, kv["forge"]),
+			desc:  version,
+			fetch: func(dest string, d *download) error { return fetchArchive(dest, url, d) },
+		}, nil
+	case kv["tag"] != "":
+		tag := kv["tag"]
+		url, err := archiveURL(prefix, kv["forge"], tag)
+		if err != nil {
+			return nil, err
+		}
+		return &depSource{
+			key:   forgeKey("tag="+tag, kv["forge"]),
+			desc:  tag,
+			fetch: func(dest string, d *download) error { return fetchArchive(dest, url, d) },
+		}, nil
+	default:
+		return nil, nil
 	}
+}
 
-	fmt.Printf("fetching %v (%v)\n", prefix, tag)
+// forgeKey returns the cache key of an archive fetched from a forge by ref,
+// and from forge, if named. Each component other than the version of a
+// release is labelled, so a tag is not cached as the release of the same
+// name; the key of a release is unchanged from earlier versions of gb.
+func forgeKey(ref, forge string) []string {
+	if forge == "" {
+		return []string{ref}
+	}
+	return []string{ref, " forge=" + forge}
+}
 
-	rc, err := fetchRelease(prefix, tag)
+// vcsSource returns a source which checks out the repository named by the
+// repo key of a vcs depfile entry.
+func vcsSource(prefix string, kv map[string]string) (*depSource, error) {
+	repo := kv["repo"]
+	if repo == "" {
+		return nil, errors.Errorf("%s: vcs=%s requires repo=url", prefix, kv["vcs"])
+	}
+	u, err := url.Parse(repo)
 	if err != nil {
-		return err
+		return nil, errors.Wrapf(err, "%s: invalid repo", prefix)
 	}
-	defer rc.Close()
-	return unpackReleaseTarball(dest, rc)
+	if u.Scheme == "" {
+		return nil, errors.Errorf("%s: repo %q must be a URL", prefix, repo)
+	}
+	branch, tag, revision := kv["branch"], kv["tag"], kv["revision"]
+	ref := branch + tag + revision
+
+	var remote func() (vendor.RemoteRepo, error)
+	switch kv["vcs"] {
+	case "git":
+		// the scheme of the URL was chosen explicitly, so permit
+		// insecure schemes.
+		remote = func() (vendor.RemoteRepo, error) { return vendor.Gitrepo(u, true, u.Scheme) }
+	case "hg":
+		remote = func() (vendor.RemoteRepo, error) { return vendor.Hgrepo(u, true, u.Scheme) }
+	default:
+		return nil, errors.Errorf("%s: unsupported vcs %q", prefix, kv["vcs"])
+	}
+	return &depSource{
+		key:   []string{"vcs=" + kv["vcs"], " repo=" + repo, " branch=" + branch, " tag=" + tag, " revision=" + revision},
+		desc:  strings.TrimSuffix(repo+" "+ref, " "),
+		local: u.Scheme == "file",
+		fetch: func(dest string, _ *download) error {
+			rr, err := remote()
+			if err != nil {
+				return err
+			}
+			wc, err := rr.Checkout(branch, tag, revision)
+			if err != nil {
+				return err
+			}
+			defer wc.Destroy()
+			return install(dest, func(dir string) error {
+				return fileutils.Copypath(dir, wc.Dir())
+			})
+		},
+	}, nil
 }
 
-func unpackReleaseTarball(dest string, r io.Reader) error {
-	gzr, err := gzip.NewReader(r)
-	if err != nil {
-		return errors.Wrap(err, "unable to construct gzip reader")
+// githubAPI is the base URL of the GitHub API.
+var githubAPI = "https://api.github.com"
+
+// forges maps hosts to the forge software they run.
+var forges = map[string]string{
+	"github.com":    "github",
+	"gitlab.com":    "gitlab",
+	"bitbucket.org": "bitbucket",
+	"gitea.com":     "gitea",
+	"codeberg.org":  "gitea",
+}
+
+// archiveURL returns the URL of the tar.gz archive of ref in the repository
+// host/owner/repo named by prefix, hosted by forge.
+func archiveURL(prefix, forge, ref string) (string, error) {
+	parts := strings.Split(prefix, "/")
+	if len(parts) != 3 {
+		return "", errors.Errorf("%s: expected an import path of the form host/owner/repo", prefix)
+	}
+	host, owner, repo := parts[0], parts[1], parts[2]
+	if forge == "" {
+		forge = forges[host]
 	}
+	switch forge {
+	case "github":
+		return fmt.Sprintf("%s/repos/%s/%s/tarball/%s", githubAPI, owner, repo, ref), nil
+	case "gitlab":
+		return fmt.Sprintf("https://%s/%s/%s/-/archive/%s/%s-%s.tar.gz", host, owner, repo, ref, repo, ref), nil
+	case "bitbucket":
+		return fmt.Sprintf("https://%s/%s/%s/get/%s.tar.gz", host, owner, repo, ref), nil
+	case "gitea":
+		return fmt.Sprintf("https://%s/%s/%s/archive/%s.tar.gz", host, owner, repo, ref), nil
+	case "":
+		return "", errors.Errorf("%s: unknown host %q, supply forge= or url=", prefix, host)
+	default:
+		return "", errors.Errorf("%s: unknown forge %q", prefix, forge)
+	}
+}
+
+// fetchArchive downloads the tar.gz, or zip if the URL ends in .zip, archive
+// at url and unpacks it to dest, counting the bytes read in d.
+func fetchArchive(dest, url string, d *download) error {
+	return httpGet(url, func(resp *http.Response) error {
+		switch resp.StatusCode {
+		case 200:
+		case 401, 403:
+			return errors.Errorf("failed to fetch %q: %s; see gb help auth to configure credentials for %s", url, resp.Status, resp.Request.URL.Host)
+		default:
+			return errors.Errorf("failed to fetch %q: expected 200, got %d", url, resp.StatusCode)
+		}
 
+		return install(dest, func(dir string) error {
+			archive := dir + ".archive"
+			body := d.reader(resp.Body, resp.ContentLength)
+			var err error
+			if strings.HasSuffix(resp.Request.URL.Path, ".zip") {
+				err = unpackZip(archive, body)
+			} else {
+				err = unpackTarball(archive, body)
+			}
+			if err != nil {
+				return err
+			}
+			return os.Rename(archiveRoot(archive), dir)
+		})
+	})
+}
+
+// install calls fill to populate a temporary directory beside dest, then
+// moves it to dest, so dest is only present once it is complete.
+func install(dest string, fill func(dir string) error) error {
 	parent, pkg := filepath.Split(dest)
 	if err := os.MkdirAll(parent, 0755); err != nil {
 		return err
@@ -139,52 +413,101 @@ func unpackReleaseTarball(dest string, r io.Reader) error {
 		return err
 	}
 	defer os.RemoveAll(tmpdir)
-
-	tmpdir = filepath.Join(tmpdir, pkg)
-
-	if err := untar.Untar(tmpdir, gzr); err != nil {
+	dir := filepath.Join(tmpdir, pkg)
+	if err := fill(dir); err != nil {
 		return err
 	}
+	return os.Rename(dir, dest)
+}
 
-	dents, err := ioutil.ReadDir(tmpdir)
+func unpackTarball(dest string, r io.Reader) error {
+	gzr, err := gzip.NewReader(r)
 	if err != nil {
-		os.RemoveAll(tmpdir)
-		return errors.Wrap(err, "cannot read download directory")
-	}
-	re := regexp.MustCompile(`\w+-\w+-[a-z0-9]+`)
-	for _, dent := range dents {
-		if re.MatchString(dent.Name()) {
-			if err := os.Rename(filepath.Join(tmpdir, dent.Name()), dest); err != nil {
-				os.RemoveAll(tmpdir)
-				return errors.Wrap(err, "unable to rename final cache dir")
-			}
-			return nil
-		}
+		return errors.Wrap(err, "unable to construct gzip reader")
 	}
-	os.RemoveAll(tmpdir)
-	return errors.New("release directory not found in tarball")
+	return untar.Untar(dest, gzr)
 }
 
-func fetchRelease(prefix, tag string) (io.ReadCloser, error) {
-	const format = "https://api.github.com/repos/%s/tarball/%s"
-	prefix = prefix[len("github.com/"):]
-	url := fmt.Sprintf(format, prefix, tag)
-	resp, err := http.Get(url)
+func unpackZip(dest string, r io.Reader) error {
+	// zip files must be read from the end, so buffer them on disk.
+	f, err := ioutil.TempFile(filepath.Dir(dest), "zip")
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to fetch %q", url)
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return errors.Wrap(err, "unable to construct zip reader")
+	}
+	for _, zf := range zr.File {
+		if strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(zf.Name))
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return errors.Errorf("invalid file name %q", zf.Name)
+		}
+		if err := unzipFile(filepath.Join(dest, name), zf); err != nil {
+			return err
+		}
 	}
-	if resp.StatusCode != 200 {
-		return nil, errors.Errorf("failed to fetch %q: expected 200, got %d", url, resp.StatusCode)
+	return nil
+}
+
+// archiveRoot returns the only directory in dir, as archives generated by
+// forges place their contents in a top level directory named after the
+// repository and revision, or dir itself if there is not exactly one.
+func archiveRoot(dir string) string {
+	dents, err := ioutil.ReadDir(dir)
+	if err != nil || len(dents) != 1 || !dents[0].IsDir() {
+		return dir
 	}
-	return resp.Body, nil
+	return filepath.Join(dir, dents[0].Name())
 }
 
 func readDepfile(ctx *Context) (map[string]map[string]string, error) {
 	file := filepath.Join(ctx.Projectdir(), "depfile")
 	ctx.debug("loading depfile at %q", file)
-	return depfile.ParseFile(file)
+	df, err := depfile.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for name, kv := range depfile.SplitOptions(df) {
+		if err := CheckDepfileOption(name, kv); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "gopath":
+			ctx.gopath = ctx.gopath || kv["enabled"] == "true"
+		}
+	}
+	return df, nil
 }
 
+// CheckDepfileOption returns an error if kv is not a valid setting for the
+// depfile project option name, such as
+//
+//     gopath enabled=true
+func CheckDepfileOption(name string, kv map[string]string) error {
+	switch name {
+	case "gopath":
+		for k, v := range kv {
+			if k != "enabled" || v != "true" && v != "false" {
+				return errors.Errorf("gopath: expected enabled=true or enabled=false, got %s=%s", k, v)
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("%s is not a depfile option", name)
+	}
+}
+
+// hash returns the sha1 of its arguments, concatenated without a separator.
 func hash(arg string, args ...string) string {
 	h := sha1.New()
 	io.WriteString(h, arg)
@@ -194,6 +517,10 @@ func hash(arg string, args ...string) string {
 	return fmt.Sprintf("%x", string(h.Sum(nil)))
 }
 
+// DepfileCache returns the directory where packages named in a project's
+// depfile are downloaded.
+func DepfileCache() string { return cachePath() }
+
 func cachePath() string {
 	return filepath.Join(gbhome(), "cache")
 }
@@ -0,0 +1,735 @@
+package gb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestArchiveURL(t *testing.T) {
+	tests := []struct {
+		prefix, forge, ref string
+		want               string
+		err                bool
+	}{{
+		prefix: "github.com/pkg/errors",
+		ref:    "v0.8.0",
+		want:   "https://api.github.com/repos/pkg/errors/tarball/v0.8.0",
+	}, {
+		prefix: "gitlab.com/user/proj",
+		ref:    "v1.0.0",
+		want:   "https://gitlab.com/user/proj/-/archive/v1.0.0/proj-v1.0.0.tar.gz",
+	}, {
+		prefix: "bitbucket.org/user/proj",
+		ref:    "v1.0.0",
+		want:   "https://bitbucket.org/user/proj/get/v1.0.0.tar.gz",
+	}, {
+		prefix: "codeberg.org/user/proj",
+		ref:    "release",
+		want:   "https://codeberg.org/user/proj/archive/release.tar.gz",
+	}, {
+		prefix: "git.example.com/user/proj",
+		forge:  "gitea",
+		ref:    "v1.0.0",
+		want:   "https://git.example.com/user/proj/archive/v1.0.0.tar.gz",
+	}, {
+		prefix: "git.example.com/user/proj",
+		ref:    "v1.0.0",
+		err:    true, // unknown host
+	}, {
+		prefix: "github.com/pkg/errors",
+		forge:  "sourceforge",
+		ref:    "v1.0.0",
+		err:    true,
+	}, {
+		prefix: "github.com/pkg/errors/sub",
+		ref:    "v1.0.0",
+		err:    true,
+	}}
+
+	for _, tt := range tests {
+		got, err := archiveURL(tt.prefix, tt.forge, tt.ref)
+		if (err != nil) != tt.err {
+			t.Errorf("archiveURL(%q, %q, %q): got err %v, want err %v", tt.prefix, tt.forge, tt.ref, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("archiveURL(%q, %q, %q): got %q, want %q", tt.prefix, tt.forge, tt.ref, got, tt.want)
+		}
+	}
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for name, contents := range files {
+		hdr := tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipfile(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDepfileArchives(t *testing.T) {
+	archives := map[string][]byte{
+		"/repos/a/release/tarball/v1.0.0": tarball(t, map[string]string{
+			"a-release-0123abc/release.go": "package release\n\nconst V = 1\n",
+		}),
+		"/tagged.tar.gz": tarball(t, map[string]string{
+			"tagged-1.0/tagged.go": "package tagged\n",
+		}),
+		"/zipped.zip": zipfile(t, map[string]string{
+			"zipped.go":      "package zipped\n",
+			"inner/inner.go": "package inner\n",
+		}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+	defer srv.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = srv.URL
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", `github.com/a/release version=1.0.0
+example.com/tagged url=`+srv.URL+`/tagged.tar.gz
+example.com/zipped url=`+srv.URL+`/zipped.zip
+`)
+	proj.tempfile("src/app/app.go", `package app
+
+import (
+	_ "example.com/tagged"
+	_ "example.com/zipped/inner"
+	_ "github.com/a/release"
+)
+`)
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range pkg.Imports {
+		if origin := dep.Origin(); origin != "depfile" {
+			t.Errorf("%s: got origin %q, want %q", dep.ImportPath, origin, "depfile")
+		}
+	}
+	// the release must be cached where earlier versions of gb put it.
+	release := filepath.Join(gbhome, "cache", hash("github.com/a/release", "1.0.0"), "src", "github.com", "a", "release", "release.go")
+	if _, err := os.Stat(release); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDepfileMissingArchive(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "example.com/missing url="+srv.URL+"/missing.tar.gz\n")
+	if _, err := NewContext(proj); err == nil {
+		t.Fatal("NewContext: expected error fetching missing archive")
+	}
+}
+
+func TestDepfileGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	repo := mktemp(t)
+	defer os.RemoveAll(repo)
+	r := &testproject{t, project{rootdir: repo}}
+	r.tempfile("lib.go", "package lib\n\nconst V = 1\n")
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=gb", "GIT_AUTHOR_EMAIL=gb@example.com", "GIT_COMMITTER_NAME=gb", "GIT_COMMITTER_EMAIL=gb@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "lib.go")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "v1.0.0")
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "example.com/lib vcs=git repo=file://"+filepath.ToSlash(repo)+" tag=v1.0.0\n")
+	proj.tempfile("src/app/app.go", "package app\n\nimport _ \"example.com/lib\"\n")
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Imports) != 1 || pkg.Imports[0].Origin() != "depfile" {
+		t.Fatalf("expected example.com/lib from the depfile, got %v", pkg.Imports)
+	}
+}
+
+func TestDepfileLock(t *testing.T) {
+	contents := "package locked\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball(t, map[string]string{"locked-1.0/locked.go": contents}))
+	}))
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "example.com/locked url="+srv.URL+"/locked.tar.gz\n")
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.WriteDepfileLock(); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Destroy()
+
+	// the cached content matches the lock.
+	ctx, err = NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Destroy()
+
+	// the cached content has been modified.
+	file := filepath.Join(gbhome, "cache", hash("example.com/locked", srv.URL+"/locked.tar.gz"), "src", "example.com", "locked", "locked.go")
+	if err := ioutil.WriteFile(file, []byte("package locked // changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewContext(proj); err == nil || !strings.Contains(err.Error(), "cached content") {
+		t.Fatalf("NewContext: got %v, want cached content error", err)
+	}
+
+	// the modified content is not locked again.
+	if _, err := NewContext(proj, IgnoreDepfileLock); err == nil || !strings.Contains(err.Error(), "when fetched") {
+		t.Fatalf("NewContext: got %v, want modified content error", err)
+	}
+
+	// the upstream content has changed.
+	if err := os.RemoveAll(filepath.Join(gbhome, "cache")); err != nil {
+		t.Fatal(err)
+	}
+	contents = "package locked // retagged\n"
+	if _, err := NewContext(proj); err == nil || !strings.Contains(err.Error(), "downloaded content") {
+		t.Fatalf("NewContext: got %v, want downloaded content error", err)
+	}
+
+	// the lock is ignored.
+	ctx, err = NewContext(proj, IgnoreDepfileLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Destroy()
+
+	// the lock describes a different source.
+	proj.tempfile("depfile", "example.com/locked url="+srv.URL+"/other.tar.gz\n")
+	if _, err := NewContext(proj); err == nil || !strings.Contains(err.Error(), "does not match depfile") {
+		t.Fatalf("NewContext: got %v, want stale lock error", err)
+	}
+
+	// the lock has no entry for the prefix.
+	proj.tempfile("depfile", "example.com/unlocked url="+srv.URL+"/unlocked.tar.gz\n")
+	if _, err := NewContext(proj); err == nil || !strings.Contains(err.Error(), "no entry for example.com/unlocked in depfile.lock") {
+		t.Fatalf("NewContext: got %v, want missing lock entry error", err)
+	}
+}
+
+func TestTreeHash(t *testing.T) {
+	dir := mktemp(t)
+	defer os.RemoveAll(dir)
+	d := &testproject{t, project{rootdir: dir}}
+	d.tempfile("a.go", "package a\n")
+	d.tempfile("b/b.go", "package b\n")
+	before, err := treeHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.tempfile("b/c.go", "package b\n")
+	after, err := treeHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Fatalf("treeHash: adding a file did not change the hash %s", before)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := os.Symlink("a.go", filepath.Join(dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	before, err = treeHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Fatalf("treeHash: adding a symlink did not change the hash %s", before)
+	}
+	os.Remove(filepath.Join(dir, "link.go"))
+	if err := os.Symlink("b/c.go", filepath.Join(dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	after, err = treeHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Fatalf("treeHash: retargeting a symlink did not change the hash %s", before)
+	}
+}
+
+func TestDepfileVersionConstraint(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.3.0", "v2.0.0", "not-a-release"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/a/ranged/tags":
+			if r.URL.Query().Get("page") != "1" {
+				w.Write([]byte("[]"))
+				return
+			}
+			var names []string
+			for _, tag := range tags {
+				names = append(names, `{"name": "`+tag+`"}`)
+			}
+			w.Write([]byte("[" + strings.Join(names, ",") + "]"))
+		case strings.HasPrefix(r.URL.Path, "/repos/a/ranged/tarball/"):
+			w.Write(tarball(t, map[string]string{"a-ranged-0123abc/ranged.go": "package ranged\n"}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = srv.URL
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "github.com/a/ranged version=^1.2.0\n")
+	proj.tempfile("src/app/app.go", "package app\n\nimport _ \"github.com/a/ranged\"\n")
+
+	// resolved returns the version of github.com/a/ranged used by the
+	// Context.
+	resolved := func(opts ...func(*Context) error) string {
+		ctx, err := NewContext(proj, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		pkg, err := ctx.ResolvePackage("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := pkg.Imports[0].Root
+		for _, v := range []string{"1.2.0", "1.3.0", "1.4.0", "2.0.0"} {
+			if root == filepath.Join(gbhome, "cache", hash("github.com/a/ranged", v)) {
+				if err := ctx.WriteDepfileLock(); err != nil {
+					t.Fatal(err)
+				}
+				return v
+			}
+		}
+		t.Fatalf("github.com/a/ranged resolved from unexpected root %s", root)
+		return ""
+	}
+
+	if got := resolved(); got != "1.3.0" {
+		t.Fatalf("version=^1.2.0: got %s, want 1.3.0", got)
+	}
+
+	// a new release does not change the version recorded in depfile.lock.
+	tags = append(tags, "v1.4.0")
+	if got := resolved(); got != "1.3.0" {
+		t.Fatalf("after release of v1.4.0: got %s, want 1.3.0", got)
+	}
+	if got := resolved(IgnoreDepfileLock); got != "1.3.0" {
+		t.Fatalf("IgnoreDepfileLock: got %s, want 1.3.0", got)
+	}
+	if got := resolved(IgnoreDepfileLock, UpdateDepfile()); got != "1.4.0" {
+		t.Fatalf("UpdateDepfile: got %s, want 1.4.0", got)
+	}
+	if got := resolved(); got != "1.4.0" {
+		t.Fatalf("after UpdateDepfile: got %s, want 1.4.0", got)
+	}
+
+	if _, err := NewContext(proj, UpdateDepfile("github.com/a/missing")); err == nil {
+		t.Fatal("UpdateDepfile: expected error updating an entry not in the depfile")
+	}
+
+	proj.tempfile("depfile", "github.com/a/ranged version=^3\n")
+	if _, err := NewContext(proj, IgnoreDepfileLock); err == nil || !strings.Contains(err.Error(), "no release matches") {
+		t.Fatalf("version=^3: got %v, want no release matches", err)
+	}
+}
+
+func TestDepfileTransitive(t *testing.T) {
+	// releases maps the tarball of each release of a repository on the
+	// test server to its contents.
+	releases := map[string]map[string]string{
+		"lib/v1.0.0": {
+			"lib.go":  "package lib\n\nimport _ \"github.com/a/util\"\n",
+			"depfile": "github.com/a/util version=1.1.0\n",
+		},
+		"util/v1.0.0": {"util.go": "package util\n\nconst V = 0\n"},
+		"util/v1.1.0": {"util.go": "package util\n\nconst V = 1\n"},
+		"util/v2.0.0": {"util.go": "package util\n\nconst V = 2\n"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/a/util/tags" {
+			if r.URL.Query().Get("page") == "1" {
+				w.Write([]byte(`[{"name": "v1.0.0"}, {"name": "v1.1.0"}, {"name": "v2.0.0"}]`))
+				return
+			}
+			w.Write([]byte("[]"))
+			return
+		}
+		files, ok := releases[strings.Replace(strings.TrimPrefix(r.URL.Path, "/repos/a/"), "/tarball/", "/", 1)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		tar := make(map[string]string)
+		for name, contents := range files {
+			tar["a-repo-0123abc/"+name] = contents
+		}
+		w.Write(tarball(t, tar))
+	}))
+	defer srv.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = srv.URL
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("src/app/app.go", "package app\n\nimport _ \"github.com/a/lib\"\nimport _ \"github.com/a/util\"\n")
+
+	tests := []struct {
+		depfile string
+		want    string // root of github.com/a/util
+		err     []string
+	}{{
+		// github.com/a/lib requires a later compatible release.
+		depfile: "github.com/a/lib version=1.0.0\ngithub.com/a/util version=^1.0.0\n",
+		want:    "1.1.0",
+	}, {
+		// an exact version in the project's depfile is not raised.
+		depfile: "github.com/a/lib version=1.0.0\ngithub.com/a/util version=1.0.0\n",
+		err: []string{
+			"conflicting requirements for github.com/a/util, selected 1.0.0:",
+			"\tversion=1.0.0, required by depfile",
+			"\tversion=1.1.0, required by github.com/a/lib 1.0.0",
+		},
+	}, {
+		// github.com/a/util is only required by github.com/a/lib.
+		depfile: "github.com/a/lib version=1.0.0\n",
+		want:    "1.1.0",
+	}, {
+		depfile: "github.com/a/lib version=1.0.0\ngithub.com/a/util version=2.0.0\n",
+		err: []string{
+			"conflicting requirements for github.com/a/util, selected 2.0.0:",
+			"\tversion=2.0.0, required by depfile",
+			"\tversion=1.1.0, required by github.com/a/lib 1.0.0",
+		},
+	}, {
+		depfile: "github.com/a/lib version=1.0.0\ngithub.com/a/util version=~1.0\n",
+		err: []string{
+			"conflicting requirements for github.com/a/util, selected 1.1.0:",
+			"\tversion=~1.0 (1.0.0), required by depfile",
+			"\tversion=1.1.0, required by github.com/a/lib 1.0.0",
+		},
+	}}
+
+	for _, tt := range tests {
+		proj.tempfile("depfile", tt.depfile)
+		ctx, err := NewContext(proj)
+		if len(tt.err) > 0 {
+			if err == nil {
+				ctx.Destroy()
+				t.Errorf("%q: expected error", tt.depfile)
+				continue
+			}
+			if got, want := errors.Cause(err).Error(), strings.Join(tt.err, "\n"); got != want {
+				t.Errorf("%q: got error\n%s\nwant\n%s", tt.depfile, got, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.depfile, err)
+			continue
+		}
+		pkg, err := ctx.ResolvePackage("app")
+		ctx.Destroy()
+		if err != nil {
+			t.Errorf("%q: %v", tt.depfile, err)
+			continue
+		}
+		for _, dep := range pkg.Imports {
+			if dep.ImportPath != "github.com/a/util" {
+				continue
+			}
+			if want := filepath.Join(gbhome, "cache", hash("github.com/a/util", tt.want)); dep.Root != want {
+				t.Errorf("%q: github.com/a/util: got root %s, want %s (%s)", tt.depfile, dep.Root, want, tt.want)
+			}
+		}
+	}
+}
+
+func TestDepfileOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball(t, map[string]string{"util-1.0/util.go": "package util\n"}))
+	}))
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	lib := mktemp(t)
+	defer os.RemoveAll(lib)
+	l := &testproject{t, project{rootdir: lib}}
+	l.tempfile("lib.go", "package lib\n\nimport _ \"example.com/util\"\n")
+	l.tempfile("sub/sub.go", "package sub\n")
+	l.tempfile("depfile", "example.com/util url="+srv.URL+"/util.tar.gz\n")
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	// the url is never fetched.
+	proj.tempfile("depfile", "example.com/lib url="+srv.URL+"/missing.tar.gz path="+filepath.ToSlash(lib)+"\n")
+	proj.tempfile("src/app/app.go", "package app\n\nimport _ \"example.com/lib\"\nimport _ \"example.com/lib/sub\"\n")
+
+	check := func(lib string) {
+		ctx, err := NewContext(proj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		if got, want := ctx.Overrides(), map[string]string{"example.com/lib": lib}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Overrides: got %v, want %v", got, want)
+		}
+		pkg, err := ctx.ResolvePackage("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dep := range pkg.Imports {
+			if origin := dep.Origin(); origin != "override" {
+				t.Errorf("%s: got origin %q, want %q", dep.ImportPath, origin, "override")
+			}
+			if dep.Root != lib {
+				t.Errorf("%s: got root %s, want %s", dep.ImportPath, dep.Root, lib)
+			}
+			// the depfile of the override is used.
+			if dep.ImportPath == "example.com/lib" && len(dep.Imports) > 0 {
+				if util := dep.Imports[0]; util.Origin() != "depfile" {
+					t.Errorf("example.com/util: got origin %q, want depfile", util.Origin())
+				}
+			}
+		}
+	}
+	check(lib)
+
+	// depfile.local takes precedence over the path key.
+	local := mktemp(t)
+	defer os.RemoveAll(local)
+	lo := &testproject{t, project{rootdir: local}}
+	lo.tempfile("lib.go", "package lib\n")
+	lo.tempfile("sub/sub.go", "package sub\n")
+	proj.tempfile("depfile.local", "example.com/lib path="+filepath.ToSlash(local)+"\n")
+	check(local)
+
+	proj.tempfile("depfile.local", "example.com/lib path=missing\n")
+	if _, err := NewContext(proj); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Fatalf("NewContext: got %v, want missing directory error", err)
+	}
+}
+
+func TestCheckDepfileEntry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/a/b/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			w.Write([]byte("[]"))
+			return
+		}
+		w.Write([]byte(`[{"name": "v1.2.0"}, {"name": "v1.3.0"}, {"name": "stable"}]`))
+	}))
+	defer srv.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = srv.URL
+
+	tests := []struct {
+		prefix string
+		kv     map[string]string
+		err    string
+	}{{
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"version": "1.2.0"},
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"version": "1.4.0"},
+		err:    "github.com/a/b: no tag v1.4.0 upstream",
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"version": "~1.3"},
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"version": "^2"},
+		err:    "github.com/a/b: no release matches version ^2",
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"version": "^x"},
+		err:    `github.com/a/b: invalid version constraint "^x"`,
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"tag": "stable"},
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"tag": "unstable"},
+		err:    "github.com/a/b: no tag unstable upstream",
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"path": "../b"},
+	}, {
+		prefix: "github.com/a/b",
+		kv:     map[string]string{"commit": "0123abc"},
+		err:    "github.com/a/b: expected a version, tag, url, vcs, path or module key",
+	}}
+
+	for _, tt := range tests {
+		err := CheckDepfileEntry(tt.prefix, tt.kv)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("CheckDepfileEntry(%q, %v): %v", tt.prefix, tt.kv, err)
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("CheckDepfileEntry(%q, %v): got %v, want %q", tt.prefix, tt.kv, err, tt.err)
+		}
+	}
+}
+
+func TestDepfileSourceKey(t *testing.T) {
+	root := func(kv map[string]string) string {
+		src, err := depfileSource("github.com/a/b", kv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash("github.com/a/b", src.key...)
+	}
+
+	tests := []struct {
+		a, b map[string]string
+	}{
+		{map[string]string{"version": "1.2.3"}, map[string]string{"tag": "1.2.3"}},
+		{map[string]string{"version": "1.2.3"}, map[string]string{"version": "1.2.3", "forge": "gitlab"}},
+		{map[string]string{"tag": "v1"}, map[string]string{"tag": "v1", "forge": "gitea"}},
+		{
+			map[string]string{"vcs": "git", "repo": "https://example.com/b", "branch": "ab"},
+			map[string]string{"vcs": "git", "repo": "https://example.com/b", "branch": "a", "tag": "b"},
+		},
+		{
+			map[string]string{"vcs": "git", "repo": "https://example.com/b", "tag": "x"},
+			map[string]string{"vcs": "git", "repo": "https://example.com/b", "revision": "x"},
+		},
+	}
+	for _, tt := range tests {
+		if root(tt.a) == root(tt.b) {
+			t.Errorf("%v and %v: got the same cache root", tt.a, tt.b)
+		}
+	}
+
+	// the cache root of a release is unchanged from earlier versions of gb.
+	if got, want := root(map[string]string{"version": "2.0.0"}), hash("github.com/a/b", "2.0.0"); got != want {
+		t.Errorf("version=2.0.0: got cache root %s, want %s", got, want)
+	}
+}
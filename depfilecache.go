@@ -0,0 +1,202 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/constabulary/gb/internal/fileutils"
+	"github.com/pkg/errors"
+)
+
+// A CacheEntry is the content of a depfile entry in $GB_HOME/cache. The
+// directories of the cache are named after a hash of the entry, so the
+// entry is recorded in an index, $GB_HOME/cache/index, when it is fetched.
+type CacheEntry struct {
+	Dir     string    // the directory holding the content
+	Prefix  string    // import path prefix of the content, "" if not in the index
+	Source  string    // the release, tag, URL or repository fetched
+	Sum     string    // sha256 of the content when it was fetched
+	Fetched time.Time // zero if unknown
+	Used    time.Time // last use by a build, zero if unknown
+}
+
+// DepfileCacheEntries returns the entries in $GB_HOME/cache, sorted by
+// prefix and source.
+func DepfileCacheEntries() ([]*CacheEntry, error) {
+	dents, err := ioutil.ReadDir(cachePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index, err := readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, dent := range dents {
+		if !dent.IsDir() {
+			continue
+		}
+		e := CacheEntry{Dir: filepath.Join(cachePath(), dent.Name())}
+		if kv, ok := index[dent.Name()]; ok {
+			e.Prefix = kv["prefix"]
+			e.Source = kv["source"]
+			e.Sum = kv["sha256"]
+			e.Fetched, _ = time.Parse(time.RFC3339, kv["fetched"])
+			e.Used, _ = time.Parse(time.RFC3339, kv["used"])
+		}
+		entries = append(entries, &e)
+	}
+	sort.Sort(byPrefix(entries))
+	return entries, nil
+}
+
+type byPrefix []*CacheEntry
+
+func (b byPrefix) Len() int      { return len(b) }
+func (b byPrefix) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPrefix) Less(i, j int) bool {
+	if b[i].Prefix != b[j].Prefix {
+		return b[i].Prefix < b[j].Prefix
+	}
+	return b[i].Source < b[j].Source
+}
+
+// Size returns the total size of the files of e.
+func (e *CacheEntry) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(e.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Verify hashes the content of e, returning an error if it does not match
+// the sha256 recorded when it was fetched.
+func (e *CacheEntry) Verify() error {
+	if e.Prefix == "" || e.Sum == "" {
+		return errors.Errorf("%s is not in the cache index", e.Dir)
+	}
+	sum, err := treeHash(filepath.Join(e.Dir, "src", filepath.FromSlash(e.Prefix)))
+	if err != nil {
+		return err
+	}
+	if sum != e.Sum {
+		return errors.Errorf("%s (%s): content has sha256 %s, expected %s", e.Prefix, e.Source, sum, e.Sum)
+	}
+	return nil
+}
+
+// ErrEntryInUse is returned by Remove if another gb process holds the lock
+// of the entry, as it does while fetching it.
+var ErrEntryInUse = errors.New("in use by another gb process")
+
+// Remove removes e from the cache and from its index, holding the lock of
+// the entry so it is not removed while another gb process is fetching it.
+// Remove does not remove the lock file itself, as a process waiting on it
+// and a process arriving later could then both take the lock.
+func (e *CacheEntry) Remove() error {
+	unlock, err := fileutils.TryLock(e.Dir + ".lock")
+	if err == fileutils.ErrLocked {
+		return ErrEntryInUse
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := fileutils.RemoveAll(e.Dir); err != nil {
+		return err
+	}
+	name := filepath.Base(e.Dir)
+	return updateCacheIndex(func(index map[string]map[string]string) {
+		delete(index, name)
+	})
+}
+
+func cacheIndexPath() string { return filepath.Join(cachePath(), "index") }
+
+// readCacheIndex returns the entries of the cache index, keyed by the name
+// of their directory in the cache.
+func readCacheIndex() (map[string]map[string]string, error) {
+	index, err := depfile.ParseFile(cacheIndexPath())
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		return make(map[string]map[string]string), nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not parse cache index")
+	default:
+		return index, nil
+	}
+}
+
+// updateCacheIndex applies update to the cache index, holding the lock of
+// the index so concurrent gb processes do not lose each other's updates.
+func updateCacheIndex(update func(map[string]map[string]string)) error {
+	if err := os.MkdirAll(cachePath(), 0755); err != nil {
+		return err
+	}
+	unlock, err := fileutils.Lock(cacheIndexPath() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := readCacheIndex()
+	if err != nil {
+		return err
+	}
+	update(index)
+	var names []string
+	for name := range index {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# index of the depfile cache, maintained by gb; do not edit.")
+	for _, name := range names {
+		fmt.Fprintln(&buf, depfile.FormatLine(name, index[name]))
+	}
+	tmp := cacheIndexPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cacheIndexPath())
+}
+
+// indexDepfileCache records the use of the content of nodes in the cache
+// index, and the entries of those which were fetched.
+func indexDepfileCache(nodes []*depNode) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return updateCacheIndex(func(index map[string]map[string]string) {
+		for _, n := range nodes {
+			name := filepath.Base(n.root)
+			kv, ok := index[name]
+			if !ok || n.fetched {
+				kv = map[string]string{
+					"prefix": n.prefix,
+					"source": n.src.desc,
+					"sha256": n.sum,
+				}
+				if n.fetched {
+					kv["fetched"] = now
+				}
+				index[name] = kv
+			}
+			kv["used"] = now
+		}
+	})
+}
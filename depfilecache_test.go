@@ -0,0 +1,91 @@
+package gb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/constabulary/gb/internal/fileutils"
+)
+
+func TestDepfileCacheIndex(t *testing.T) {
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball(t, map[string]string{"dep-1.0/dep.go": "package dep\n"}))
+	}))
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	url := srv.URL + "/dep.tar.gz"
+	proj.tempfile("depfile", "example.com/dep url="+url+"\n")
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Destroy()
+
+	entries, err := DepfileCacheEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("DepfileCacheEntries: got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Dir != filepath.Join(gbhome, "cache", hash("example.com/dep", url)) || e.Prefix != "example.com/dep" || e.Source != url {
+		t.Fatalf("DepfileCacheEntries: got %+v", e)
+	}
+	if e.Fetched.IsZero() || e.Used.Before(e.Fetched) {
+		t.Errorf("DepfileCacheEntries: fetched %v, used %v", e.Fetched, e.Used)
+	}
+	if err := e.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(e.Dir, "src", "example.com", "dep", "dep.go"), []byte("package changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(); err == nil {
+		t.Error("Verify: expected error verifying changed content")
+	}
+
+	// an entry is not removed while another process holds its lock.
+	unlock, err := fileutils.Lock(e.Dir + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Remove(); err != ErrEntryInUse {
+		t.Fatalf("Remove: want ErrEntryInUse, got %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(e.Dir); err != nil {
+		t.Fatalf("Remove: removed an entry in use: %v", err)
+	}
+
+	if err := e.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = DepfileCacheEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := readCacheIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 || len(index) != 0 {
+		t.Errorf("after Remove: got %d entries, %d in the index, want none", len(entries), len(index))
+	}
+}
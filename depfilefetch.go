@@ -0,0 +1,213 @@
+package gb
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/constabulary/gb/internal/auth"
+	"github.com/pkg/errors"
+)
+
+// FetchJobs configures the Context to fetch at most n depfile entries at
+// once.
+func FetchJobs(n int) func(*Context) error {
+	return func(c *Context) error {
+		if n < 1 {
+			return errors.Errorf("fetch jobs must be at least 1, got %d", n)
+		}
+		c.fetchJobs = n
+		return nil
+	}
+}
+
+// fetchResult is the content a requirement resolved to.
+type fetchResult struct {
+	kv       map[string]string // the entry, with its version constraint resolved
+	resolved string            // the release chosen, if kv had a version constraint
+	src      *depSource
+	root     string
+	fetched  bool
+	err      error
+}
+
+// fetchAll resolves and fetches the content of each of reqs which is not
+// overridden, fetching up to ctx.fetchJobs entries at once. The result for
+// each requirement is returned at the same index as the requirement.
+func fetchAll(ctx *Context, reqs []*requirement, lock map[string]map[string]string) []fetchResult {
+	results := make([]fetchResult, len(reqs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	workers := ctx.fetchJobs
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for n := range work {
+				r := reqs[n]
+				res := &results[n]
+				res.kv, res.resolved, res.err = resolveVersion(ctx, r.prefix, r.kv, lock[r.prefix])
+				if res.err != nil {
+					continue
+				}
+				res.src, res.root, res.fetched, res.err = fetchDep(r.prefix, res.kv)
+			}
+		}()
+	}
+	for n, r := range reqs {
+		if ctx.override(r.prefix) == nil {
+			work <- n
+		}
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// progress serialises the reports of concurrent downloads.
+type progress struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (p *progress) printf(format string, args ...interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	fmt.Fprintf(p.w, format, args...)
+}
+
+// fetchProgress reports the progress of depfile downloads to the user.
+var fetchProgress = &progress{w: os.Stdout}
+
+// reportInterval is the minimum time between reports of the progress of a
+// single download.
+const reportInterval = time.Second
+
+// A download counts the bytes read while fetching a depfile entry, reporting
+// its progress every reportInterval.
+type download struct {
+	prefix string
+	n      int64 // bytes read so far
+	last   time.Time
+}
+
+// reader returns a reader which counts the bytes read from r, the body of
+// a response of length size, or -1 if unknown, starting the count again if
+// the request is retried.
+func (d *download) reader(r io.Reader, size int64) io.Reader {
+	d.n, d.last = 0, time.Now()
+	return &meter{Reader: r, d: d, size: size}
+}
+
+type meter struct {
+	io.Reader
+	d    *download
+	size int64
+}
+
+func (m *meter) Read(b []byte) (int, error) {
+	n, err := m.Reader.Read(b)
+	m.d.n += int64(n)
+	if now := time.Now(); now.Sub(m.d.last) >= reportInterval {
+		m.d.last = now
+		if m.size > 0 {
+			fetchProgress.printf("%s: %s of %s\n", m.d.prefix, FormatSize(m.d.n), FormatSize(m.size))
+		} else {
+			fetchProgress.printf("%s: %s\n", m.d.prefix, FormatSize(m.d.n))
+		}
+	}
+	return n, err
+}
+
+// FormatSize formats n bytes for the user.
+func FormatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+}
+
+// retries is the number of times a request which fails with a transient
+// error is retried. retryDelay is the delay before the first retry, doubled
+// before each subsequent one.
+var (
+	retries    = 3
+	retryDelay = time.Second
+)
+
+// httpGet issues a GET to url, with the credentials configured for its
+// host, and calls read with the response. The request is retried if it
+// fails with a transient network error, if the status of the response
+// indicates a transient failure of the server, or if read fails with a
+// transient error while reading the body.
+func httpGet(url string, read func(*http.Response) error) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := httpGetOnce(url, read)
+		if err == nil || attempt == retries || !transient(err) {
+			return err
+		}
+		fetchProgress.printf("fetching %s failed: %v; retrying in %v\n", url, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func httpGetOnce(url string, read func(*http.Response) error) error {
+	resp, err := auth.Get(url)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch %q", url)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &statusError{url: url, status: resp.Status}
+	}
+	return read(resp)
+}
+
+// A statusError is the response of a server which failed, but may not fail
+// again.
+type statusError struct {
+	url, status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to fetch %q: %s", e.url, e.status)
+}
+
+// transient reports whether err may not recur if the request is retried.
+// Errors such as unknown hosts or invalid certificates are not transient.
+func transient(err error) bool {
+	err = errors.Cause(err)
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*net.OpError); ok {
+		if dns, ok := e.Err.(*net.DNSError); ok {
+			return dns.Timeout() || dns.Temporary()
+		}
+		// the connection was refused, reset or timed out.
+		return true
+	}
+	switch err := err.(type) {
+	case *statusError:
+		return true
+	case net.Error:
+		return err.Timeout() || err.Temporary()
+	default:
+		return err == io.ErrUnexpectedEOF
+	}
+}
@@ -0,0 +1,210 @@
+package gb
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHTTPGetRetry(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	tests := []struct {
+		failures int // requests which fail before succeeding
+		fail     func(w http.ResponseWriter)
+		requests int // requests made
+		err      bool
+	}{
+		{0, nil, 1, false},
+		{2, unavailable, 3, false},
+		{retries, unavailable, retries + 1, false},
+		{retries + 1, unavailable, retries + 1, true},
+		{2, truncated, 3, false},
+		{1, notFound, 1, true},
+	}
+
+	for _, tt := range tests {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= tt.failures {
+				tt.fail(w)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		err := httpGet(srv.URL, func(resp *http.Response) error {
+			if resp.StatusCode != 200 {
+				return fmt.Errorf("got status %d", resp.StatusCode)
+			}
+			_, err := ioutil.ReadAll(resp.Body)
+			return err
+		})
+		srv.Close()
+		if (err != nil) != tt.err {
+			t.Errorf("httpGet after %d failures: got error %v, want error %v", tt.failures, err, tt.err)
+		}
+		if requests != tt.requests {
+			t.Errorf("httpGet after %d failures: got %d requests, want %d", tt.failures, requests, tt.requests)
+		}
+	}
+}
+
+func unavailable(w http.ResponseWriter) { w.WriteHeader(503) }
+
+func notFound(w http.ResponseWriter) { w.WriteHeader(404) }
+
+// truncated sends a response shorter than its Content-Length.
+func truncated(w http.ResponseWriter) {
+	w.Header().Set("Content-Length", "10")
+	w.Write([]byte("ok"))
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&statusError{url: "u", status: "503 Service Unavailable"}, true},
+		{errors.Wrap(io.ErrUnexpectedEOF, "read"), true},
+		{&url.Error{Op: "Get", URL: "u", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid"}}}, false},
+		{&url.Error{Op: "Get", URL: "u", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, true},
+		{errors.New("expected 200, got 404"), false},
+	}
+
+	for _, tt := range tests {
+		if got := transient(tt.err); got != tt.want {
+			t.Errorf("transient(%v): got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatSize(tt.n); got != tt.want {
+			t.Errorf("FormatSize(%d): got %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDepfileConcurrentFetch(t *testing.T) {
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Write(tarball(t, map[string]string{"dep/dep.go": "package dep\n"}))
+	}))
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", `example.com/a url=`+srv.URL+`/a.tar.gz
+example.com/b url=`+srv.URL+`/b.tar.gz
+example.com/c url=`+srv.URL+`/c.tar.gz
+`)
+
+	// contexts sharing GB_HOME must fetch each entry once between them.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, err := NewContext(proj, FetchJobs(2))
+			if err != nil {
+				errs <- err
+				return
+			}
+			ctx.Destroy()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for _, path := range []string{"/a.tar.gz", "/b.tar.gz", "/c.tar.gz"} {
+		if requests[path] != 1 {
+			t.Errorf("%s: fetched %d times, want 1", path, requests[path])
+		}
+	}
+}
+
+func TestDepfileAuth(t *testing.T) {
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write(tarball(t, map[string]string{"dep/dep.go": "package dep\n"}))
+	}))
+	defer srv.Close()
+
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GB_HOME", gbhome)
+	defer os.Setenv("NETRC", os.Getenv("NETRC"))
+	os.Setenv("NETRC", filepath.Join(gbhome, "netrc"))
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "example.com/private url="+srv.URL+"/private.tar.gz\n")
+
+	_, err := NewContext(proj)
+	if err == nil || !strings.Contains(err.Error(), "gb help auth") {
+		t.Fatalf("NewContext without credentials: got %v, want error mentioning gb help auth", err)
+	}
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(gbhome, "auth"), []byte(u.Host+" token=secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatalf("NewContext with credentials: %v", err)
+	}
+	ctx.Destroy()
+}
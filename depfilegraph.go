@@ -0,0 +1,286 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/constabulary/gb/internal/semver"
+	"github.com/pkg/errors"
+)
+
+// A requirement is an entry in the depfile of the project, or in the depfile
+// of a package fetched for it.
+type requirement struct {
+	prefix string
+	kv     map[string]string // the entry, as written
+	by     string            // the depfile containing the entry
+	node   *depNode          // the content the entry resolved to
+}
+
+// wrap annotates err with the depfile containing r, if it is not the
+// project's.
+func (r *requirement) wrap(err error) error {
+	if r.by == "depfile" {
+		return err
+	}
+	return errors.Wrapf(err, "required by %s", r.by)
+}
+
+// pins reports whether r is an exact version in the project's depfile,
+// which is used even if the depfile of a dependency requires a later
+// release.
+func (r *requirement) pins() bool {
+	return r.by == "depfile" && isVersion(r.kv["version"])
+}
+
+// A depNode is the fetched content of one or more requirements.
+type depNode struct {
+	prefix   string
+	entry    map[string]string // the entry recorded in depfile.lock
+	version  string            // release of the content, if fetched by version
+	src      *depSource
+	root     string // cache root holding the content
+	sum      string // sha256 of the content, once verified
+	dest     string // directory of prefix within root
+	fetched  bool   // fetched, rather than found in the cache
+	override bool   // replaced by a local directory
+}
+
+// depGraph holds the requirements of the project and of each package
+// fetched for it.
+type depGraph struct {
+	reqs  map[string][]*requirement // by prefix
+	nodes map[string]*depNode       // by cache root
+}
+
+// loadDepGraph fetches the content of each of reqs, then the content of
+// the requirements in the depfiles at the top of that content, and so on,
+// returning the graph of all requirements found. The requirements found at
+// each step are fetched concurrently.
+func loadDepGraph(ctx *Context, reqs []*requirement, lock map[string]map[string]string) (*depGraph, error) {
+	g := depGraph{
+		reqs:  make(map[string][]*requirement),
+		nodes: make(map[string]*depNode),
+	}
+	queue := reqs
+	for len(queue) > 0 {
+		batch := queue
+		queue = nil
+		results := fetchAll(ctx, batch, lock)
+		for i, r := range batch {
+			g.reqs[r.prefix] = append(g.reqs[r.prefix], r)
+
+			if o := ctx.override(r.prefix); o != nil {
+				key := "override:" + o.dir
+				if n, ok := g.nodes[key]; ok {
+					r.node = n
+					continue
+				}
+				n := &depNode{prefix: r.prefix, dest: o.dir, override: true}
+				r.node = n
+				g.nodes[key] = n
+				if err := g.addDepfile(ctx, n, r.prefix+" "+o.dir, &queue); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			res := results[i]
+			if res.err != nil {
+				return nil, r.wrap(res.err)
+			}
+			if res.src == nil {
+				continue
+			}
+			if n, ok := g.nodes[res.root]; ok {
+				r.node = n
+				continue
+			}
+			entry := r.kv
+			if res.resolved != "" {
+				entry = copyEntry(entry)
+				entry["resolved"] = res.resolved
+			}
+			n := &depNode{
+				prefix:  r.prefix,
+				entry:   entry,
+				version: res.kv["version"],
+				src:     res.src,
+				root:    res.root,
+				dest:    filepath.Join(res.root, "src", filepath.FromSlash(r.prefix)),
+				fetched: res.fetched,
+			}
+			r.node = n
+			g.nodes[res.root] = n
+			if err := g.addDepfile(ctx, n, r.prefix+" "+res.src.desc, &queue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &g, nil
+}
+
+// addDepfile appends the requirements in the depfile at the top of the
+// content of n, if any, to queue. by describes n.
+func (g *depGraph) addDepfile(ctx *Context, n *depNode, by string, queue *[]*requirement) error {
+	df, err := depfile.ParseFile(filepath.Join(n.dest, "depfile"))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not parse depfile of %s", n.prefix)
+	}
+	if opts := depfile.SplitOptions(df); len(opts) > 0 {
+		// project options apply only to the project.
+		ctx.debug("ignoring options in depfile of %s", by)
+	}
+	for _, prefix := range sortedPrefixes(df) {
+		kv := df[prefix]
+		if kv["module"] != "" || kv["path"] != "" {
+			// only the project may use these.
+			ctx.debug("ignoring %s in depfile of %s", prefix, by)
+			continue
+		}
+		*queue = append(*queue, &requirement{prefix: prefix, kv: kv, by: by})
+	}
+	return nil
+}
+
+// selectVersions returns the content chosen for each prefix in the graph,
+// sorted by prefix.
+//
+// When every requirement of a prefix names a version, an exact version in
+// the project's depfile is chosen. Otherwise the highest of the versions
+// required is chosen, as the depfile of each dependency names the minimum
+// version it needs; there, an exact version, version=1.2.3, accepts any
+// later compatible release, as if written version=^1.2.3. The chosen
+// version must satisfy every requirement. Otherwise, the requirements of a
+// prefix must all name the same content. An overridden prefix always uses
+// its local directory.
+//
+// If the requirements of any prefix conflict, selectVersions returns an
+// error listing each of them, and the depfile they were found in.
+func (g *depGraph) selectVersions() ([]*depNode, error) {
+	var prefixes []string
+	for prefix := range g.reqs {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var selected []*depNode
+	var conflicts []string
+	for _, prefix := range prefixes {
+		var reqs []*requirement
+		for _, r := range g.reqs[prefix] {
+			if r.node != nil {
+				reqs = append(reqs, r)
+			}
+		}
+		if len(reqs) == 0 {
+			continue
+		}
+		sel, ok := selectNode(reqs)
+		if !ok {
+			conflicts = append(conflicts, conflictReport(prefix, sel, reqs))
+			continue
+		}
+		selected = append(selected, sel)
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.New(strings.Join(conflicts, "\n"))
+	}
+	return selected, nil
+}
+
+// selectNode returns the content chosen for reqs, the requirements of a
+// single prefix, and whether it satisfies all of them.
+func selectNode(reqs []*requirement) (*depNode, bool) {
+	for _, r := range reqs {
+		if r.node.override {
+			// overrides replace every requirement.
+			return r.node, true
+		}
+	}
+	var sel *depNode
+	var selv semver.Version
+	var pinned bool
+	for _, r := range reqs {
+		if r.node.version == "" {
+			sel = nil
+			break
+		}
+		v, err := semver.Parse(r.node.version)
+		if err != nil {
+			return nil, false
+		}
+		switch {
+		case pinned:
+		case r.pins():
+			sel, selv, pinned = r.node, v, true
+		case sel == nil || semver.Compare(v, selv) > 0:
+			sel, selv = r.node, v
+		}
+	}
+	if sel == nil {
+		// not all versions, every requirement must name the same content.
+		for _, r := range reqs {
+			if r.node != reqs[0].node {
+				return nil, false
+			}
+		}
+		return reqs[0].node, true
+	}
+	for _, r := range reqs {
+		if !accepts(r.kv["version"], sel.version, selv) {
+			return sel, false
+		}
+	}
+	return sel, true
+}
+
+// accepts reports whether the version or version constraint required
+// accepts the release v.
+func accepts(required, version string, v semver.Version) bool {
+	if required == version {
+		return true
+	}
+	if isVersion(required) {
+		// an exact version in the depfile of a dependency is a minimum.
+		required = "^" + required
+	}
+	c, err := semver.ParseConstraint(required)
+	return err == nil && c.Check(v)
+}
+
+// conflictReport describes the conflicting requirements of prefix.
+func conflictReport(prefix string, sel *depNode, reqs []*requirement) string {
+	var buf bytes.Buffer
+	if sel != nil {
+		fmt.Fprintf(&buf, "conflicting requirements for %s, selected %s:", prefix, sel.version)
+	} else {
+		fmt.Fprintf(&buf, "conflicting requirements for %s:", prefix)
+	}
+	for _, r := range reqs {
+		fmt.Fprintf(&buf, "\n\t%s", strings.TrimSpace(depfile.FormatLine("", r.kv)))
+		if v := r.node.version; v != "" && v != r.kv["version"] {
+			fmt.Fprintf(&buf, " (%s)", v)
+		}
+		fmt.Fprintf(&buf, ", required by %s", r.by)
+	}
+	return buf.String()
+}
+
+// sortedPrefixes returns the prefixes of the entries in a depfile, sorted.
+func sortedPrefixes(df map[string]map[string]string) []string {
+	var prefixes []string
+	for prefix := range df {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
@@ -0,0 +1,154 @@
+package gb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/pkg/errors"
+)
+
+// IgnoreDepfileLock configures the Context not to verify the content of
+// depfile entries against $PROJECT/depfile.lock. Hashes given by sha256 keys
+// in the depfile itself are still verified, and the versions chosen for
+// version constraints are still used.
+func IgnoreDepfileLock(c *Context) error {
+	c.ignoreLock = true
+	return nil
+}
+
+// readDepfileLock returns the entries of $PROJECT/depfile.lock, or nil if
+// there is none.
+func readDepfileLock(ctx *Context) (map[string]map[string]string, error) {
+	file := filepath.Join(ctx.Projectdir(), "depfile.lock")
+	lock, err := depfile.ParseFile(file)
+	if os.IsNotExist(errors.Cause(err)) {
+		ctx.debug("no depfile.lock, not verifying depfile content")
+		return nil, nil
+	}
+	return lock, err
+}
+
+// expectedSum returns the hash the content of the depfile entry kv for
+// prefix must have, or "" if it is not known. lock is the entry for prefix
+// in depfile.lock, if any, which must describe the same source as kv.
+func expectedSum(prefix string, kv, lock map[string]string) (string, error) {
+	want := kv["sha256"]
+	if lock == nil {
+		return want, nil
+	}
+	if !sameSource(kv, lock) {
+		return "", errors.Errorf("%s: depfile.lock does not match depfile; run 'gb depfile lock'", prefix)
+	}
+	if want != "" && lock["sha256"] != want {
+		return "", errors.Errorf("%s: depfile.lock has sha256 %s, depfile has %s", prefix, lock["sha256"], want)
+	}
+	return lock["sha256"], nil
+}
+
+// sameSource reports whether the depfile entries a and b are equal,
+// ignoring the keys recorded by depfile.lock.
+func sameSource(a, b map[string]string) bool {
+	return sourceKeys(a) == sourceKeys(b)
+}
+
+// sourceKeys returns the keys of the depfile entry kv, other than those
+// recorded by depfile.lock, as a string.
+func sourceKeys(kv map[string]string) string {
+	kv = copyEntry(kv)
+	delete(kv, "sha256")
+	delete(kv, "resolved")
+	return depfile.FormatLine("", kv)
+}
+
+// lockDepfile records the hash of the content of the depfile entry kv for
+// prefix, to be written by WriteDepfileLock.
+func (c *Context) lockDepfile(prefix string, kv map[string]string, sum string) {
+	entry := copyEntry(kv)
+	entry["sha256"] = sum
+	if c.depfileSums == nil {
+		c.depfileSums = make(map[string]map[string]string)
+	}
+	c.depfileSums[prefix] = entry
+}
+
+// WriteDepfileLock writes $PROJECT/depfile.lock, recording the hash of the
+// content of each depfile entry fetched by the Context.
+func (c *Context) WriteDepfileLock() error {
+	var prefixes []string
+	for prefix := range c.depfileSums {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# generated by gb depfile lock; do not edit.")
+	for _, prefix := range prefixes {
+		fmt.Fprintln(&buf, depfile.FormatLine(prefix, c.depfileSums[prefix]))
+	}
+	return ioutil.WriteFile(filepath.Join(c.Projectdir(), "depfile.lock"), buf.Bytes(), 0644)
+}
+
+// treeHash returns the hash of the regular files and symlinks below dir, the
+// sha256 of a listing of the sha256 and slash separated path of each file,
+// sorted by path. A symlink is hashed by the path of its target, so
+// retargeting it changes the hash.
+func treeHash(dir string) (string, error) {
+	sums := make(map[string]string)
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var sum string
+		switch {
+		case info.Mode().IsRegular():
+			sum, err = fileHash(path)
+		case info.Mode()&os.ModeSymlink != 0:
+			var target string
+			target, err = os.Readlink(path)
+			sum = fmt.Sprintf("%x", sha256.Sum256([]byte("symlink "+filepath.ToSlash(target))))
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sums[rel] = sum
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s  %s\n", sums[path], path)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,236 @@
+package gb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// mirror returns the URL or directory of the depfile mirror, set by
+// GB_MIRROR, or "" if there is none. A mirror holds a tar.gz archive of the
+// content of each depfile entry, named after the entry's directory in
+// $GB_HOME/cache, so entries can be fetched from a local HTTP server or
+// directory rather than from their upstream repositories.
+func mirror() string {
+	return strings.TrimSuffix(os.Getenv("GB_MIRROR"), "/")
+}
+
+// mirrorName returns the name of the archive of the content cached in root.
+func mirrorName(root string) string {
+	return filepath.Base(root) + ".tar.gz"
+}
+
+// fetchMirror unpacks the archive of the content cached in root from the
+// mirror into dest, reporting whether the mirror has it.
+func fetchMirror(m, root, dest string, d *download) (bool, error) {
+	name := mirrorName(root)
+	unpack := func(r io.Reader, size int64) error {
+		return install(dest, func(dir string) error {
+			return unpackMirror(dir, d.reader(r, size))
+		})
+	}
+	if strings.HasPrefix(m, "http://") || strings.HasPrefix(m, "https://") {
+		url := m + "/" + name
+		var found bool
+		err := httpGet(url, func(resp *http.Response) error {
+			switch resp.StatusCode {
+			case 200:
+			case 404:
+				return nil
+			default:
+				return errors.Errorf("failed to fetch %q: expected 200, got %d", url, resp.StatusCode)
+			}
+			found = true
+			return unpack(resp.Body, resp.ContentLength)
+		})
+		return found && err == nil, err
+	}
+	f, err := os.Open(filepath.Join(m, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	err = unpack(f, fi.Size())
+	return err == nil, err
+}
+
+// WriteDepfileMirror writes an archive of the content of each depfile entry
+// used by the Context to dir, creating it if necessary, so dir can be used
+// as GB_MIRROR. Overridden entries are not written.
+func (c *Context) WriteDepfileMirror(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, n := range c.depfileNodes {
+		file := filepath.Join(dir, mirrorName(n.root))
+		if err := writeTarball(file, n.dest); err != nil {
+			return errors.Wrapf(err, "could not write archive of %s", n.prefix)
+		}
+		c.debug("wrote %s to %s", n.prefix, file)
+	}
+	return nil
+}
+
+// unpackMirror extracts the regular files and symlinks of the tar.gz archive
+// in r, written by writeTarball, to dest. Symlinks are created after every
+// file, so no file is written through one, and must stay within dest.
+func unpackMirror(dest string, r io.Reader) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to construct gzip reader")
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gzr)
+	var links []*tar.Header
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dest, filepath.FromSlash(h.Name))
+		if !within(dest, path) {
+			return errors.Errorf("%s: path escapes the archive", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeReg:
+			if err := writeFile(path, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			links = append(links, h)
+		default:
+			return errors.Errorf("%s: unsupported header type: %c", h.Name, rune(h.Typeflag))
+		}
+	}
+
+	realdest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, h := range links {
+		path := filepath.Join(dest, filepath.FromSlash(h.Name))
+		target := filepath.FromSlash(h.Linkname)
+		if err := mkdir(filepath.Dir(path)); err != nil {
+			return err
+		}
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) || !within(realdest, parent) || !within(realdest, filepath.Join(parent, target)) {
+			return errors.Errorf("%s: symlink to %s escapes the archive", h.Name, h.Linkname)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	// a target may still escape by way of another symlink.
+	for _, path := range paths {
+		resolved, err := filepath.EvalSymlinks(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !within(realdest, resolved) {
+			return errors.Errorf("%s: symlink escapes the archive", path)
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeTarball writes the regular files and symlinks below dir to a tar.gz
+// archive at path, replacing it only once the archive is complete.
+func writeTarball(path, dir string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gzw := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gzw)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var target string
+		switch {
+		case info.Mode().IsRegular():
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, filepath.ToSlash(target))
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,188 @@
+package gb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDepfileMirror(t *testing.T) {
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dep.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(tarball(t, map[string]string{
+			"dep-1.0/dep.go":      "package dep\n",
+			"dep-1.0/inner/in.go": "package inner\n",
+			"dep-1.0/testdata/.x": "hidden\n",
+		}))
+	}))
+	defer srv.Close()
+
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	defer os.Setenv("GB_MIRROR", os.Getenv("GB_MIRROR"))
+	defer os.Setenv("GB_OFFLINE", os.Getenv("GB_OFFLINE"))
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("depfile", "example.com/dep url="+srv.URL+"/dep.tar.gz\n")
+	proj.tempfile("src/app/app.go", "package app\n\nimport _ \"example.com/dep/inner\"\n")
+
+	// newContext returns a Context for proj with an empty cache.
+	var gbhomes []string
+	defer func() {
+		for _, dir := range gbhomes {
+			os.RemoveAll(dir)
+		}
+	}()
+	newContext := func() (*Context, error) {
+		gbhome := mktemp(t)
+		gbhomes = append(gbhomes, gbhome)
+		os.Setenv("GB_HOME", gbhome)
+		return NewContext(proj)
+	}
+
+	ctx, err := newContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.WriteDepfileLock(); err != nil {
+		t.Fatal(err)
+	}
+	dir := mktemp(t)
+	defer os.RemoveAll(dir)
+	if err := ctx.WriteDepfileMirror(dir); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Destroy()
+
+	os.Setenv("GB_OFFLINE", "1")
+	if _, err := newContext(); err == nil || !strings.Contains(err.Error(), "GB_OFFLINE") {
+		t.Fatalf("offline without a mirror: got %v, want network access disabled error", err)
+	}
+
+	mirrorSrv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer mirrorSrv.Close()
+	for _, m := range []string{dir, mirrorSrv.URL} {
+		os.Setenv("GB_MIRROR", m)
+		ctx, err := newContext()
+		if err != nil {
+			t.Fatalf("GB_MIRROR=%s: %v", m, err)
+		}
+		// the content must match depfile.lock.
+		if _, err := ctx.ResolvePackage("app"); err != nil {
+			t.Errorf("GB_MIRROR=%s: %v", m, err)
+		}
+		ctx.Destroy()
+	}
+
+	// a mirror without the entry falls back to the network, when online.
+	os.Setenv("GB_MIRROR", mktemp(t))
+	defer os.RemoveAll(os.Getenv("GB_MIRROR"))
+	if _, err := newContext(); err == nil {
+		t.Fatal("offline with an empty mirror: expected error")
+	}
+	os.Setenv("GB_OFFLINE", "0")
+	ctx, err = newContext()
+	if err != nil {
+		t.Fatalf("online with an empty mirror: %v", err)
+	}
+	ctx.Destroy()
+}
+
+func TestDepfileMirrorSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not supported")
+	}
+	defer func(w *progress) { fetchProgress = w }(fetchProgress)
+	fetchProgress = &progress{w: ioutil.Discard}
+
+	src := mktemp(t)
+	defer os.RemoveAll(src)
+	d := &testproject{t, project{rootdir: src}}
+	d.tempfile("a.go", "package a\n")
+	d.tempfile("b/b.go", "package b\n")
+	for link, target := range map[string]string{
+		"link.go":  "a.go",
+		"b/up.go":  "../a.go",
+		"c":        "b",
+		"dangling": "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := treeHash(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := mktemp(t)
+	defer os.RemoveAll(m)
+	root := filepath.Join(m, "cache", "0123")
+	if err := writeTarball(filepath.Join(m, mirrorName(root)), src); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(m, "dest")
+	found, err := fetchMirror(m, root, dest, &download{prefix: "example.com/a"})
+	if !found || err != nil {
+		t.Fatalf("fetchMirror: got %v, %v, want true, nil", found, err)
+	}
+	after, err := treeHash(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Fatalf("treeHash: got %s after the mirror, want %s", after, before)
+	}
+}
+
+func TestUnpackMirrorEscapingSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not supported")
+	}
+	tests := []map[string]string{
+		{"up": "..", "up/x": "a.go"},
+		{"abs": "/etc/passwd"},
+		{"b/up": "../../x"},
+		{"self": ".", "x": "self/.."},
+	}
+	for _, links := range tests {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gzw)
+		var names []string
+		for name := range links {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			hdr := &tar.Header{Name: name, Linkname: links[name], Typeflag: tar.TypeSymlink, Mode: 0777}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		gzw.Close()
+
+		dir := mktemp(t)
+		err := unpackMirror(filepath.Join(dir, "dest"), &buf)
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), "escapes the archive") {
+			t.Errorf("unpackMirror(%v): got %v, want escapes the archive error", links, err)
+		}
+	}
+}
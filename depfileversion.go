@@ -0,0 +1,222 @@
+package gb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/constabulary/gb/internal/auth"
+	"github.com/constabulary/gb/internal/gomod"
+	"github.com/constabulary/gb/internal/semver"
+	"github.com/constabulary/gb/internal/vendor"
+	"github.com/pkg/errors"
+)
+
+// UpdateDepfile configures the Context to resolve the version constraints
+// of the named depfile entries, or all entries if none are named, against
+// the releases of their upstream repositories, rather than using the
+// versions previously chosen in depfile.lock.
+func UpdateDepfile(prefixes ...string) func(*Context) error {
+	return func(c *Context) error {
+		c.updateDepfile = true
+		c.updatePrefixes = make(map[string]bool)
+		for _, prefix := range prefixes {
+			c.updatePrefixes[prefix] = true
+		}
+		return nil
+	}
+}
+
+// updating reports whether the version constraint of the depfile entry for
+// prefix should be resolved again.
+func (c *Context) updating(prefix string) bool {
+	return c.updateDepfile && (len(c.updatePrefixes) == 0 || c.updatePrefixes[prefix])
+}
+
+// isVersion reports whether version is a SemVer 2.0.0 version, rather than
+// a version constraint.
+func isVersion(version string) bool {
+	return semverRegex.MatchString(version)
+}
+
+// resolveVersion returns the depfile entry kv for prefix with its version
+// constraint replaced by the highest release satisfying it, and that
+// release, or kv and "" if kv does not have a version constraint.
+// The release recorded in lock, the entry for prefix in depfile.lock, is
+// used if it still satisfies the constraint, otherwise the releases are
+// listed from the upstream repository.
+func resolveVersion(ctx *Context, prefix string, kv, lock map[string]string) (map[string]string, string, error) {
+	version := kv["version"]
+	if version == "" || isVersion(version) {
+		return kv, "", nil
+	}
+	c, err := semver.ParseConstraint(version)
+	if err != nil {
+		return nil, "", errors.Wrap(err, prefix)
+	}
+
+	var resolved string
+	if lock != nil && !ctx.updating(prefix) && sameSource(kv, lock) {
+		if v, err := semver.Parse(lock["resolved"]); err == nil && c.Check(v) {
+			resolved = lock["resolved"]
+		}
+	}
+	if resolved == "" {
+		tags, err := repoTags(prefix, kv["forge"])
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "%s: could not list releases", prefix)
+		}
+		var versions []string
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, "v") {
+				versions = append(versions, tag[1:])
+			}
+		}
+		var ok bool
+		resolved, ok = c.Highest(versions)
+		if !ok {
+			return nil, "", errors.Errorf("%s: no release matches version %s", prefix, version)
+		}
+		ctx.debug("resolved %s version %s to %s", prefix, version, resolved)
+	}
+	kv = copyEntry(kv)
+	kv["version"] = resolved
+	return kv, resolved, nil
+}
+
+func copyEntry(kv map[string]string) map[string]string {
+	m := make(map[string]string, len(kv))
+	for k, v := range kv {
+		m[k] = v
+	}
+	return m
+}
+
+// repoTags returns the tags of the repository named by prefix, hosted by
+// forge. Tags are listed with the GitHub API for repositories on GitHub,
+// and with git ls-remote otherwise.
+func repoTags(prefix, forge string) ([]string, error) {
+	parts := strings.Split(prefix, "/")
+	if len(parts) != 3 {
+		return nil, errors.Errorf("expected an import path of the form host/owner/repo")
+	}
+	if vendor.Offline() {
+		return nil, errors.New("network access is disabled by GB_OFFLINE; run gb depfile update on a machine with network access to record the release to use in depfile.lock")
+	}
+	if forge == "" {
+		forge = forges[parts[0]]
+	}
+	if forge == "github" {
+		return githubTags(parts[1], parts[2])
+	}
+	url := "https://" + prefix
+	env, err := auth.GitEnv(url)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "ls-remote", "--tags", url)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "git ls-remote")
+	}
+	var tags []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/tags/") || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+	return tags, sc.Err()
+}
+
+// githubTags returns the tags of the GitHub repository owner/repo.
+func githubTags(owner, repo string) ([]string, error) {
+	var tags []string
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=100&page=%d", githubAPI, owner, repo, page)
+		var result []struct {
+			Name string `json:"name"`
+		}
+		err := httpGet(url, func(resp *http.Response) error {
+			if resp.StatusCode != 200 {
+				return errors.Errorf("failed to fetch %q: expected 200, got %d", url, resp.StatusCode)
+			}
+			return errors.Wrapf(json.NewDecoder(resp.Body).Decode(&result), "could not decode %q", url)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(result) == 0 {
+			return tags, nil
+		}
+		for _, t := range result {
+			tags = append(tags, t.Name)
+		}
+	}
+}
+
+// CheckDepfileEntry returns an error if kv is not a valid depfile entry for
+// prefix. The version or tag of an entry fetched from a forge must exist in
+// the upstream repository; a version constraint must match at least one of
+// its releases.
+func CheckDepfileEntry(prefix string, kv map[string]string) error {
+	switch {
+	case kv["module"] != "":
+		return gomod.CheckVersion(prefix, kv["module"])
+	case kv["vcs"] != "" || kv["url"] != "":
+		_, err := depfileSource(prefix, kv)
+		return err
+	case kv["version"] != "" || kv["tag"] != "":
+		ref := kv["tag"]
+		var c *semver.Constraint
+		if version := kv["version"]; version != "" {
+			ref = "v" + version
+			if !isVersion(version) {
+				var err error
+				c, err = semver.ParseConstraint(version)
+				if err != nil {
+					return errors.Wrap(err, prefix)
+				}
+			}
+		}
+		if _, err := archiveURL(prefix, kv["forge"], ref); err != nil {
+			return err
+		}
+		tags, err := repoTags(prefix, kv["forge"])
+		if err != nil {
+			return errors.Wrapf(err, "%s: could not list releases", prefix)
+		}
+		if c != nil {
+			var versions []string
+			for _, tag := range tags {
+				if strings.HasPrefix(tag, "v") {
+					versions = append(versions, tag[1:])
+				}
+			}
+			if _, ok := c.Highest(versions); !ok {
+				return errors.Errorf("%s: no release matches version %s", prefix, kv["version"])
+			}
+			return nil
+		}
+		for _, tag := range tags {
+			if tag == ref {
+				return nil
+			}
+		}
+		return errors.Errorf("%s: no tag %s upstream", prefix, ref)
+	case kv["path"] != "":
+		return nil
+	default:
+		return errors.Errorf("%s: expected a version, tag, url, vcs, path or module key", prefix)
+	}
+}
@@ -71,7 +71,11 @@ func (t *gcToolchain) Asm(pkg *Package, ofile, sfile string) error {
 func (t *gcToolchain) Ld(pkg *Package) error {
 	// to ensure we don't write a partial binary, link the binary to a temporary file in
 	// in the target directory, then rename.
-	dir := pkg.bindir()
+	binfile, err := pkg.binfile()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(binfile)
 	if err := mkdir(dir); err != nil {
 		return err
 	}
@@ -96,7 +100,7 @@ func (t *gcToolchain) Ld(pkg *Package) error {
 		io.Copy(os.Stderr, &buf)
 		return err
 	}
-	return os.Rename(tmp.Name(), pkg.Binfile())
+	return os.Rename(tmp.Name(), binfile)
 }
 
 func (t *gcToolchain) Cc(pkg *Package, ofile, cfile string) error {
@@ -149,6 +153,11 @@ func (t *gcToolchain) Gc(pkg *Package, files []string) error {
 				args = append(args, "-importmap", path[len("vendor/"):]+"="+path)
 			}
 		}
+	} else {
+		for _, path := range pkg.nestedVendorImports() {
+			i := strings.LastIndex(path, "/vendor/")
+			args = append(args, "-importmap", path[i+len("/vendor/"):]+"="+path)
+		}
 	}
 
 	args = append(args, files...)
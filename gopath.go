@@ -0,0 +1,61 @@
+package gb
+
+import (
+	"go/build"
+	"path/filepath"
+	"runtime"
+)
+
+// WithGOPATH adds a read only importer for each $GOPATH entry, searched
+// after $PROJECT/vendor/src, so packages not yet moved into the project can
+// still be resolved. It can also be enabled with the depfile option
+//
+//     gopath enabled=true
+func WithGOPATH(c *Context) error {
+	c.gopath = true
+	return nil
+}
+
+// addGopathDeps adds an importer for each $GOPATH entry, other than the
+// project itself and GOROOT, above i, so the first entry is searched first.
+func addGopathDeps(bc *build.Context, ctx *Context, i Importer) Importer {
+	roots := gopathRoots(ctx.Projectdir())
+	for n := len(roots) - 1; n >= 0; n-- {
+		i = &_importer{
+			Importer: i,
+			im: importer{
+				Context: bc,
+				Root:    roots[n],
+			},
+		}
+		ctx.debug("add importer for $GOPATH entry: %v", roots[n])
+	}
+	ctx.gopathRoots = roots
+	return i
+}
+
+// gopathRoots returns the entries of $GOPATH, excluding projectdir and GOROOT.
+func gopathRoots(projectdir string) []string {
+	var roots []string
+	for _, root := range filepath.SplitList(build.Default.GOPATH) {
+		if root == "" || !filepath.IsAbs(root) {
+			continue
+		}
+		root = filepath.Clean(root)
+		if root == projectdir || root == runtime.GOROOT() {
+			continue
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// isGopath reports whether pkg was resolved from a $GOPATH entry.
+func (pkg *Package) isGopath() bool {
+	for _, root := range pkg.gopathRoots {
+		if pkg.Root == root {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// Package auth supplies the credentials gb uses to access private
+// repositories and import servers over HTTP.
+//
+// Credentials for a host are taken from the first of
+//
+//	$GB_HOME/auth, lines of the form
+//		host token=secret [user=name]
+//		host user=name password=secret
+//	GB_GITHUB_TOKEN, GB_GITLAB_TOKEN or GB_BITBUCKET_TOKEN, for the
+//	hosts of those forges and their APIs
+//	$NETRC, or ~/.netrc if it is not set
+//
+// which has an entry for the host. An entry for host:port only matches
+// requests to that port; an entry for host matches any port. Tokens are
+// sent as bearer tokens, except to git, which only supports basic
+// authentication, where they are sent as the password of user.
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/pkg/errors"
+)
+
+// credentials for a single host.
+type credentials struct {
+	user, password string
+	token          string // used instead of password, if set
+}
+
+// header returns the value of the Authorization header of an HTTP request.
+func (c *credentials) header() string {
+	if c.token != "" {
+		return "Bearer " + c.token
+	}
+	return basic(c.user, c.password)
+}
+
+// gitHeader returns the value of the Authorization header sent by git.
+func (c *credentials) gitHeader() string {
+	if c.token == "" {
+		return basic(c.user, c.password)
+	}
+	user := c.user
+	if user == "" {
+		user = "gb"
+	}
+	return basic(user, c.token)
+}
+
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// forgeTokens are the environment variables holding tokens for forges, the
+// hosts they apply to, and the user a token is sent as to git.
+var forgeTokens = []struct {
+	env   string
+	hosts []string
+	user  string
+}{
+	{"GB_GITHUB_TOKEN", []string{"github.com", "api.github.com"}, "x-access-token"},
+	{"GB_GITLAB_TOKEN", []string{"gitlab.com"}, "oauth2"},
+	{"GB_BITBUCKET_TOKEN", []string{"bitbucket.org", "api.bitbucket.org"}, "x-token-auth"},
+}
+
+// lookup returns the credentials for host, which may include a port, or
+// nil if there are none.
+func lookup(host string) (*credentials, error) {
+	names := []string{host}
+	if i := strings.LastIndex(host, ":"); i > 0 && !strings.HasSuffix(host, "]") {
+		names = append(names, host[:i])
+	}
+
+	config, err := depfile.ParseFile(configPath())
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+	case err != nil:
+		return nil, errors.Wrapf(err, "could not parse %s", configPath())
+	}
+	for _, name := range names {
+		if kv, ok := config[name]; ok {
+			c := credentials{user: kv["user"], password: kv["password"], token: kv["token"]}
+			if c.token == "" && c.user == "" {
+				return nil, errors.Errorf("%s: %s: expected a token or user key", configPath(), name)
+			}
+			return &c, nil
+		}
+	}
+
+	for _, name := range names {
+		for _, f := range forgeTokens {
+			token := os.Getenv(f.env)
+			if token == "" {
+				continue
+			}
+			for _, h := range f.hosts {
+				if h == name {
+					return &credentials{user: f.user, token: token}, nil
+				}
+			}
+		}
+	}
+
+	machines, err := readNetrc(netrcPath())
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+	case err != nil:
+		return nil, err
+	}
+	for _, name := range names {
+		for _, m := range machines {
+			if m.name == name {
+				return &credentials{user: m.login, password: m.password}, nil
+			}
+		}
+	}
+	for _, m := range machines {
+		if m.name == "" {
+			// the default entry.
+			return &credentials{user: m.login, password: m.password}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Header returns the value of the Authorization header for HTTP requests
+// to host, or "" if there are no credentials for host.
+func Header(host string) (string, error) {
+	c, err := lookup(host)
+	if c == nil || err != nil {
+		return "", err
+	}
+	return c.header(), nil
+}
+
+// Get issues a GET to url, with the credentials for its host, and for the
+// host of each redirect.
+func Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(req); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+var client = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return authorize(req)
+	},
+}
+
+// authorize adds the credentials for the host of req, if any, to req.
+func authorize(req *http.Request) error {
+	h, err := Header(req.URL.Host)
+	if err != nil {
+		return err
+	}
+	if h != "" {
+		req.Header.Set("Authorization", h)
+	}
+	return nil
+}
+
+// GitEnv returns the environment variables which make git send the
+// credentials for the host of the http or https URL rawurl, or nil if
+// there are none. The credentials are passed in the environment, rather
+// than the command line, so they are not visible to other users.
+func GitEnv(rawurl string) ([]string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, err
+	}
+	c, err := lookup(u.Host)
+	if c == nil || err != nil {
+		return nil, err
+	}
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + u.Scheme + "://" + u.Host + "/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: " + c.gitHeader(),
+	}, nil
+}
+
+// configPath returns the path of the credentials file, $GB_HOME/auth.
+func configPath() string {
+	home := os.Getenv("GB_HOME")
+	if home == "" {
+		home = filepath.Join(homeDir(), ".gb")
+	}
+	return filepath.Join(home, "auth")
+}
+
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	return "/tmp"
+}
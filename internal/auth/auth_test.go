@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		data string
+		want []machine
+	}{{
+		data: "machine example.com login me password secret\n",
+		want: []machine{{"example.com", "me", "secret"}},
+	}, {
+		data: `machine a.example.com
+	login a
+	password pa
+macdef init
+	machine b.example.com login b password pb
+
+machine c.example.com login c account x password pc
+default login anon password guest
+`,
+		want: []machine{
+			{"a.example.com", "a", "pa"},
+			{"c.example.com", "c", "pc"},
+			{"", "anon", "guest"},
+		},
+	}}
+
+	for _, tt := range tests {
+		got := parseNetrc(tt.data)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseNetrc(%q): got %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+// setup points GB_HOME and NETRC at files holding config and netrc in a
+// temporary directory, and unsets the forge token variables, returning a
+// function which restores them.
+func setup(t *testing.T, config, netrc string) func() {
+	dir, err := ioutil.TempDir("", "auth_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := []string{"GB_HOME", "NETRC", "GB_GITHUB_TOKEN", "GB_GITLAB_TOKEN", "GB_BITBUCKET_TOKEN"}
+	saved := make(map[string]string)
+	for _, v := range vars {
+		saved[v] = os.Getenv(v)
+		os.Unsetenv(v)
+	}
+	os.Setenv("GB_HOME", dir)
+	os.Setenv("NETRC", filepath.Join(dir, "netrc"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "auth"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "netrc"), []byte(netrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		for _, v := range vars {
+			os.Setenv(v, saved[v])
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	defer setup(t, `
+git.example.com token=abc
+git.example.com:8443 user=me password="p w"
+`, `
+machine git.example.com login netrc password x
+machine github.com login netrc password y
+machine other.example.com login other password z
+`)()
+	os.Setenv("GB_GITHUB_TOKEN", "gh")
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"git.example.com", "Bearer abc"},
+		{"git.example.com:443", "Bearer abc"},
+		{"git.example.com:8443", basic("me", "p w")},
+		{"github.com", "Bearer gh"},
+		{"api.github.com", "Bearer gh"},
+		{"other.example.com", basic("other", "z")},
+		{"unknown.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := Header(tt.host)
+		if err != nil {
+			t.Errorf("Header(%q): %v", tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Header(%q): got %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	// target requires credentials, and is reached by a redirect from
+	// origin, which does not.
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "me" || password != "secret" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.RedirectHandler(target.URL+"/file", 302))
+	defer origin.Close()
+
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(url string) int {
+		resp, err := Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	restore := setup(t, "", "")
+	if got := get(target.URL); got != 401 {
+		t.Errorf("without credentials: got %d, want 401", got)
+	}
+	restore()
+
+	defer setup(t, "", "machine "+u.Host+" login me password secret\n")()
+	if got := get(target.URL); got != 200 {
+		t.Errorf("with credentials: got %d, want 200", got)
+	}
+	if got := get(origin.URL); got != 200 {
+		t.Errorf("redirected with credentials: got %d, want 200", got)
+	}
+}
+
+func TestGitEnv(t *testing.T) {
+	defer setup(t, "git.example.com token=abc\n", "")()
+
+	env, err := GitEnv("https://git.example.com/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.https://git.example.com/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: " + basic("gb", "abc"),
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("GitEnv: got %v, want %v", env, want)
+	}
+
+	for _, rawurl := range []string{"https://other.example.com/repo.git", "ssh://git.example.com/repo.git"} {
+		env, err := GitEnv(rawurl)
+		if err != nil || env != nil {
+			t.Errorf("GitEnv(%q): got %v, %v, want no variables", rawurl, env, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A machine is an entry in a .netrc file.
+type machine struct {
+	name            string // "" for the default entry
+	login, password string
+}
+
+// netrcPath returns the path of the user's .netrc file, $NETRC if set.
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(homeDir(), name)
+}
+
+// readNetrc reads the machine and default entries of the .netrc file at
+// path. Macro definitions are skipped.
+func readNetrc(path string) ([]machine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "readNetrc")
+	}
+	return parseNetrc(string(data)), nil
+}
+
+func parseNetrc(data string) []machine {
+	var machines []machine
+	var m *machine
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			switch fields[j] {
+			case "machine", "default":
+				machines = append(machines, machine{})
+				m = &machines[len(machines)-1]
+				if fields[j] == "machine" && j+1 < len(fields) {
+					j++
+					m.name = fields[j]
+				}
+			case "login", "password", "account":
+				if j+1 >= len(fields) {
+					continue
+				}
+				j++
+				if m == nil {
+					continue
+				}
+				switch fields[j-1] {
+				case "login":
+					m.login = fields[j]
+				case "password":
+					m.password = fields[j]
+				}
+			case "macdef":
+				// the macro runs until the next blank line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return machines
+}
@@ -0,0 +1,145 @@
+// Package buildcache implements a remote build cache over HTTP.
+//
+// The protocol is deliberately simple. An entry is stored by issuing a PUT
+// request to $URL/$KEY with the contents of the entry as the request body,
+// and retrieved by issuing a GET request to the same location. A missing
+// entry is reported with a 404 status.
+package buildcache
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HTTP is a cache client which stores entries on a remote HTTP server.
+type HTTP struct {
+	// URL is the base url of the cache server.
+	URL string
+
+	// Client is the http.Client used to talk to the server. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewHTTP returns a HTTP cache client for the server at url.
+func NewHTTP(url string) *HTTP {
+	return &HTTP{
+		URL: strings.TrimSuffix(url, "/"),
+	}
+}
+
+func (h *HTTP) client() *http.Client {
+	if h.Client != nil {
+		return h.Client
+	}
+	return http.DefaultClient
+}
+
+// Get fetches the entry stored under key.
+func (h *HTTP) Get(key string) (io.ReadCloser, error) {
+	url := h.URL + "/" + key
+	resp, err := h.client().Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %q", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("failed to fetch %q: expected 200, got %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Put stores the contents of r under key.
+func (h *HTTP) Put(key string, r io.Reader) error {
+	url := h.URL + "/" + key
+	req, err := http.NewRequest("PUT", url, r)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store %q", url)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	default:
+		return errors.Errorf("failed to store %q: expected 201, got %d", url, resp.StatusCode)
+	}
+}
+
+// Server is a http.Handler which serves a build cache from a directory
+// on local disk. It is intended as a reference implementation of the
+// cache protocol, not a production cache server.
+type Server struct {
+	// Dir is the directory in which entries are stored.
+	Dir string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if !validKey(key) {
+		http.Error(w, fmt.Sprintf("invalid key %q", key), http.StatusBadRequest)
+		return
+	}
+	path := s.path(key)
+	switch r.Method {
+	case "GET", "HEAD":
+		http.ServeFile(w, r, path)
+	case "PUT":
+		if err := s.put(path, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// path returns the location of key on disk. Entries are spread across
+// subdirectories named for the first two characters of the key.
+func (s *Server) path(key string) string {
+	return filepath.Join(s.Dir, key[:2], key)
+}
+
+// put writes the contents of r to path. The contents are written to a
+// temporary file which is renamed into place so concurrent readers never
+// observe a partial entry.
+func (s *Server) put(path string, r io.Reader) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".put")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// validKey returns true if key is a lower case hex string of a reasonable
+// length. This prevents keys escaping the cache directory.
+func validKey(key string) bool {
+	if len(key) < 8 || len(key) > 128 {
+		return false
+	}
+	return strings.Trim(key, "0123456789abcdef") == ""
+}
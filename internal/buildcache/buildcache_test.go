@@ -0,0 +1,78 @@
+package buildcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTTPRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(&Server{Dir: dir})
+	defer srv.Close()
+
+	c := NewHTTP(srv.URL + "/")
+	const key = "0123456789abcdef0123456789abcdef"
+
+	if _, err := c.Get(key); err == nil {
+		t.Fatalf("Get(%q): expected error for missing key", key)
+	}
+
+	if err := c.Put(key, strings.NewReader("archive")); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+
+	rc, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer rc.Close()
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "archive" {
+		t.Fatalf("Get(%q): want %q, got %q", key, "archive", got)
+	}
+}
+
+func TestServerRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/", http.StatusBadRequest},
+		{"GET", "/../../etc/passwd", http.StatusBadRequest},
+		{"PUT", "/ABCDEF0123456789", http.StatusBadRequest},
+		{"PUT", "/abc", http.StatusBadRequest},
+		{"DELETE", "/0123456789abcdef", http.StatusMethodNotAllowed},
+		{"GET", "/0123456789abcdef", http.StatusNotFound},
+	}
+
+	dir, err := ioutil.TempDir("", "buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := &Server{Dir: dir}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: want %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -39,6 +40,10 @@ func ParseFile(path string) (map[string]map[string]string, error) {
 //     // third kind of comment
 //       lines starting with blank lines are also ignored
 //     github.com/pkg/sftp version=0.2.1
+//
+// Values containing whitespace may be enclosed in double quotes
+//
+//     github.com/pkg/errors version=">=0.8.0 <1"
 func Parse(r io.Reader) (map[string]map[string]string, error) {
 	sc := bufio.NewScanner(r)
 	m := make(map[string]map[string]string)
@@ -68,6 +73,29 @@ func Parse(r io.Reader) (map[string]map[string]string, error) {
 	return m, sc.Err()
 }
 
+// options are the names reserved for depfile lines which set an option of
+// the project, rather than naming the import path prefix of a package.
+var options = map[string]bool{
+	"gopath": true, // gopath enabled=true
+}
+
+// IsOption reports whether name is reserved for a project option.
+func IsOption(name string) bool { return options[name] }
+
+// SplitOptions removes the project options from the tagged key value map m,
+// as returned by Parse, leaving only the entries naming packages. The
+// options are returned in a map of their own.
+func SplitOptions(m map[string]map[string]string) map[string]map[string]string {
+	opts := make(map[string]map[string]string)
+	for name, kv := range m {
+		if IsOption(name) {
+			opts[name] = kv
+			delete(m, name)
+		}
+	}
+	return opts
+}
+
 func parseLine(line string) (string, map[string]string, error) {
 	args := splitLine(line)
 	name, rest := args[0], args[1:]
@@ -91,7 +119,7 @@ func parseKeyVal(args []string) (map[string]string, error) {
 		if strings.HasSuffix(kv, "=") {
 			return nil, fmt.Errorf("expected key=value pair, missing value %q", kv)
 		}
-		args := strings.Split(kv, "=")
+		args := strings.SplitN(kv, "=", 2)
 		switch len(args) {
 		case 2:
 			key := args[0]
@@ -121,35 +149,56 @@ func isLetterOrNumber(r byte) bool {
 
 // splitLine is like strings.Split(string, " "), but splits
 // strings by any whitespace characters, discarding them in
-// the process.
+// the process. Whitespace between double quotes does not split
+// the string, and the quotes are discarded.
 func splitLine(line string) []string {
 	var s []string
-	var start, end int
-	for ; start < len(line); start++ {
-		c := line[start]
-		if !isWhitespace(c) {
-			break
-		}
-	}
-	var ws bool
-	for end = start; end < len(line); end++ {
-		c := line[end]
-		if !isWhitespace(c) {
-			ws = false
-			continue
-		}
-		if ws == true {
-			start++
-			continue
+	var field []byte
+	var infield, quoted bool
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			infield = true
+		case isWhitespace(c) && !quoted:
+			if infield {
+				s = append(s, string(field))
+				field = field[:0]
+				infield = false
+			}
+		default:
+			field = append(field, c)
+			infield = true
 		}
-		ws = true
-		s = append(s, line[start:end])
-		start = end + 1
 	}
-	if start != end {
-		s = append(s, line[start:end])
+	if infield {
+		s = append(s, string(field))
 	}
 	return s
 }
 
 func isWhitespace(c byte) bool { return c == ' ' || c == '\t' }
+
+// FormatLine returns a line which Parse will read as name followed by the
+// key value pairs in kv, sorted by key.
+func FormatLine(name string, kv map[string]string) string {
+	var keys []string
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	line := name
+	for _, k := range keys {
+		line += " " + k + "=" + quote(kv[k])
+	}
+	return line
+}
+
+// quote encloses v in double quotes if it contains whitespace.
+func quote(v string) string {
+	if strings.IndexAny(v, " \t") >= 0 {
+		return `"` + v + `"`
+	}
+	return v
+}
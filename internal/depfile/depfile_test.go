@@ -35,6 +35,11 @@ func TestParseKeyVal(t *testing.T) {
 	}, {
 		args: []string{"version=1.2.3", "//", "comment"},
 		err:  fmt.Errorf("expected key=value pair, got %q", "//"),
+	}, {
+		args: []string{"version=>=1.2.3"},
+		want: map[string]string{
+			"version": ">=1.2.3",
+		},
 	}, {
 		args: []string{"vcs=git", "version=1.2.3"},
 		want: map[string]string{
@@ -181,6 +186,8 @@ func TestSplitLine(t *testing.T) {
 		{s: "a\tb", want: []string{"a", "b"}},
 		{s: "a \tb", want: []string{"a", "b"}},
 		{s: "\ta \tb ", want: []string{"a", "b"}},
+		{s: `a b="c d"`, want: []string{"a", "b=c d"}},
+		{s: `a "b c"  d`, want: []string{"a", "b c", "d"}},
 	}
 
 	for _, tt := range tests {
@@ -190,3 +197,44 @@ func TestSplitLine(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatLine(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   map[string]string
+		want string
+	}{{
+		name: "github.com/pkg/profile",
+		kv:   map[string]string{"version": "1.2.3"},
+		want: "github.com/pkg/profile version=1.2.3",
+	}, {
+		name: "github.com/pkg/errors",
+		kv:   map[string]string{"version": ">=0.8.0 <1", "forge": "github"},
+		want: `github.com/pkg/errors forge=github version=">=0.8.0 <1"`,
+	}}
+
+	for _, tt := range tests {
+		got := FormatLine(tt.name, tt.kv)
+		if got != tt.want {
+			t.Errorf("FormatLine(%q, %v): got %q, want %q", tt.name, tt.kv, got, tt.want)
+		}
+		name, kv, err := parseLine(got)
+		if err != nil || name != tt.name || !reflect.DeepEqual(kv, tt.kv) {
+			t.Errorf("parseLine(%q): got %q, %v, %v, want %q, %v", got, name, kv, err, tt.name, tt.kv)
+		}
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	m := map[string]map[string]string{
+		"github.com/pkg/profile": {"version": "1.2.3"},
+		"gopath":                 {"enabled": "true"},
+	}
+	opts := SplitOptions(m)
+	if want := map[string]map[string]string{"gopath": {"enabled": "true"}}; !reflect.DeepEqual(opts, want) {
+		t.Errorf("SplitOptions: got options %v, want %v", opts, want)
+	}
+	if want := map[string]map[string]string{"github.com/pkg/profile": {"version": "1.2.3"}}; !reflect.DeepEqual(m, want) {
+		t.Errorf("SplitOptions: got entries %v, want %v", m, want)
+	}
+}
@@ -0,0 +1,173 @@
+package depfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// File is a depfile which can be edited and written back, preserving its
+// comments, blank lines and the order of its entries.
+type File struct {
+	lines []line
+}
+
+// line is a line of a File; either an entry, or text which Parse ignores.
+type line struct {
+	text string   // the line as read, or "" if the entry has been changed
+	name string   // the name of the entry, or "" if text is ignored
+	keys []string // the keys of the entry, in order
+	kv   map[string]string
+}
+
+// ReadFile reads the depfile at path.
+func ReadFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile")
+	}
+	defer r.Close()
+	return Read(r)
+}
+
+// Read reads a depfile from r. See Parse for the syntax of the file.
+func Read(r io.Reader) (*File, error) {
+	var f File
+	sc := bufio.NewScanner(r)
+	var lineno int
+	for sc.Scan() {
+		text := sc.Text()
+		lineno++
+		if text == "" || !isLetterOrNumber(text[0]) {
+			f.lines = append(f.lines, line{text: text})
+			continue
+		}
+		name, kv, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		if f.find(name) >= 0 {
+			return nil, fmt.Errorf("%d: duplicate entry %q", lineno, name)
+		}
+		var keys []string
+		for _, arg := range splitLine(text)[1:] {
+			keys = append(keys, strings.SplitN(arg, "=", 2)[0])
+		}
+		f.lines = append(f.lines, line{text: text, name: name, keys: keys, kv: kv})
+	}
+	return &f, sc.Err()
+}
+
+func (f *File) find(name string) int {
+	for i := range f.lines {
+		if f.lines[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Names returns the names of the entries in f which name packages, in
+// order. Project options are not included.
+func (f *File) Names() []string {
+	var names []string
+	for _, l := range f.lines {
+		if l.name != "" && !IsOption(l.name) {
+			names = append(names, l.name)
+		}
+	}
+	return names
+}
+
+// Entry returns a copy of the key value pairs of the entry name, or nil if
+// f has no such entry.
+func (f *File) Entry(name string) map[string]string {
+	i := f.find(name)
+	if i < 0 {
+		return nil
+	}
+	kv := make(map[string]string)
+	for k, v := range f.lines[i].kv {
+		kv[k] = v
+	}
+	return kv
+}
+
+// Set sets the keys of the entry name to the values in kv, adding the entry
+// to the end of f if it is not present. Keys with an empty value are
+// removed from the entry. Existing keys keep their position, new keys are
+// added after them in sorted order.
+func (f *File) Set(name string, kv map[string]string) {
+	i := f.find(name)
+	if i < 0 {
+		f.lines = append(f.lines, line{name: name, kv: make(map[string]string)})
+		i = len(f.lines) - 1
+	}
+	l := &f.lines[i]
+	var keys []string
+	for _, k := range l.keys {
+		if v, ok := kv[k]; ok && v == "" {
+			delete(l.kv, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	var added []string
+	for k, v := range kv {
+		if v == "" {
+			continue
+		}
+		if _, ok := l.kv[k]; !ok {
+			added = append(added, k)
+		}
+		l.kv[k] = v
+	}
+	sort.Strings(added)
+	l.keys = append(keys, added...)
+	l.text = ""
+}
+
+// Remove removes the entry name from f, reporting whether it was present.
+func (f *File) Remove(name string) bool {
+	i := f.find(name)
+	if i < 0 {
+		return false
+	}
+	f.lines = append(f.lines[:i], f.lines[i+1:]...)
+	return true
+}
+
+// WriteTo writes f to w. Lines which have not been changed are written as
+// they were read.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, l := range f.lines {
+		switch {
+		case l.text != "" || l.name == "":
+			buf.WriteString(l.text)
+		default:
+			buf.WriteString(l.name)
+			for _, k := range l.keys {
+				buf.WriteString(" " + k + "=" + quote(l.kv[k]))
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.WriteTo(w)
+}
+
+// WriteFile writes f to path.
+func (f *File) WriteFile(path string) error {
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
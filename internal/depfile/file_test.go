@@ -0,0 +1,106 @@
+package depfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	const input = `# dependencies
+github.com/pkg/profile	version=1.2.3
+
+; others
+github.com/pkg/sftp version=">=1.0.0 <2"   forge=github
+  indented comment
+gopath enabled=true
+`
+	f, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != input {
+		t.Fatalf("WriteTo: got\n%s\nwant\n%s", got, input)
+	}
+	if got, want := f.Names(), []string{"github.com/pkg/profile", "github.com/pkg/sftp"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Names: got %v, want %v", got, want)
+	}
+}
+
+func TestFileEdit(t *testing.T) {
+	tests := []struct {
+		edit func(*File)
+		want string
+	}{{
+		edit: func(f *File) { f.Set("github.com/pkg/sftp", map[string]string{"version": "^1.1", "sha256": "abc"}) },
+		want: `# dependencies
+github.com/pkg/profile	version=1.2.3
+
+; others
+github.com/pkg/sftp version=^1.1 forge=github sha256=abc
+`,
+	}, {
+		edit: func(f *File) { f.Set("github.com/pkg/sftp", map[string]string{"forge": ""}) },
+		want: `# dependencies
+github.com/pkg/profile	version=1.2.3
+
+; others
+github.com/pkg/sftp version=">=1.0.0 <2"
+`,
+	}, {
+		edit: func(f *File) { f.Set("github.com/pkg/errors", map[string]string{"version": "0.8.0"}) },
+		want: `# dependencies
+github.com/pkg/profile	version=1.2.3
+
+; others
+github.com/pkg/sftp version=">=1.0.0 <2"   forge=github
+github.com/pkg/errors version=0.8.0
+`,
+	}, {
+		edit: func(f *File) {
+			if !f.Remove("github.com/pkg/profile") || f.Remove("github.com/pkg/missing") {
+				t.Error("Remove: unexpected result")
+			}
+		},
+		want: `# dependencies
+
+; others
+github.com/pkg/sftp version=">=1.0.0 <2"   forge=github
+`,
+	}}
+
+	for i, tt := range tests {
+		f, err := Read(strings.NewReader(`# dependencies
+github.com/pkg/profile	version=1.2.3
+
+; others
+github.com/pkg/sftp version=">=1.0.0 <2"   forge=github
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.edit(f)
+		var buf bytes.Buffer
+		if _, err := f.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%d: got\n%s\nwant\n%s", i, got, tt.want)
+		}
+		if _, err := Parse(strings.NewReader(buf.String())); err != nil {
+			t.Errorf("%d: Parse: %v", i, err)
+		}
+	}
+}
+
+func TestReadDuplicate(t *testing.T) {
+	_, err := Read(strings.NewReader("a version=1.0.0\na version=2.0.0\n"))
+	if err == nil {
+		t.Fatal("Read: expected duplicate entry error")
+	}
+}
@@ -15,6 +15,9 @@ import (
 const debugCopypath = false
 const debugCopyfile = false
 
+// ErrLocked is returned by TryLock if another process holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
 // Copypath copies the contents of src to dst, excluding any file or
 // directory that starts with a period.
 func Copypath(dst string, src string) error {
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestCopypathSkipsSymlinks(t *testing.T) {
@@ -26,3 +27,62 @@ func mktemp(t *testing.T) string {
 	}
 	return s
 }
+
+func TestLock(t *testing.T) {
+	dir := mktemp(t)
+	defer RemoveAll(dir)
+	path := filepath.Join(dir, "lock")
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func() error)
+	go func() {
+		unlock, err := Lock(path)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Lock: acquired a lock which is already held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case unlock := <-locked:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock: lock not acquired after it was released")
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	dir := mktemp(t)
+	defer RemoveAll(dir)
+	path := filepath.Join(dir, "lock")
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryLock(path); err != ErrLocked {
+		t.Fatalf("TryLock: want ErrLocked, got %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock: lock not acquired after it was released: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
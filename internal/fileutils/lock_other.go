@@ -0,0 +1,64 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package fileutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lockTimeout is how long Lock waits for another process to release the
+// lock before giving up.
+var lockTimeout = 10 * time.Minute
+
+// Lock takes an exclusive lock on the file at path, waiting until any other
+// process holding the lock releases it. The lock is released by calling
+// unlock.
+//
+// On this platform the lock is the existence of path, which is created
+// exclusively, holding the pid of its owner, and removed by unlock. A lock
+// held by a process which exits without calling unlock must be removed by
+// hand, so Lock returns an error naming path if the lock is not released
+// within lockTimeout.
+func Lock(path string) (unlock func() error, err error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			f.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			owner := "another process"
+			if pid, err := ioutil.ReadFile(path); err == nil && len(pid) > 0 {
+				owner = "process " + strings.TrimSpace(string(pid))
+			}
+			return nil, errors.Errorf("timed out after %v waiting for %s to release the lock %s; if it is no longer running, remove the lock", lockTimeout, owner, path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TryLock takes an exclusive lock on the file at path, returning ErrLocked
+// rather than waiting if another process holds the lock.
+func TryLock(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, os.Getpid())
+	f.Close()
+	return func() error { return os.Remove(path) }, nil
+}
@@ -0,0 +1,59 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Lock takes an exclusive lock on the file at path, creating it if
+// necessary, waiting until any other process holding the lock releases it.
+// The lock is released by calling unlock, or when the process exits.
+func Lock(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "could not lock %s", path)
+	}
+	return func() error {
+		// closing the file releases the lock.
+		return f.Close()
+	}, nil
+}
+
+// TryLock takes an exclusive lock on the file at path, creating it if
+// necessary, returning ErrLocked rather than waiting if another process
+// holds the lock.
+func TryLock(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		return nil, ErrLocked
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "could not lock %s", path)
+	}
+	return f.Close, nil
+}
@@ -0,0 +1,198 @@
+// Package gomod reads the module path and requirements of a go.mod file,
+// and locates modules in the module cache.
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// A File is a parsed go.mod file.
+type File struct {
+	Module  string    // module path
+	Require []Require // required modules, in the order they appear
+}
+
+// A Require is a required module version.
+type Require struct {
+	Path    string
+	Version string
+}
+
+// ParseFile parses the go.mod file at path.
+// See Parse for the subset of the syntax understood.
+func ParseFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ParseFile")
+	}
+	defer r.Close()
+	return Parse(r)
+}
+
+// Parse parses the contents of r as a go.mod file. Only the module and
+// require directives, single line or in a block, are interpreted. The
+// replace and exclude directives, which would change the modules required,
+// are not supported and are reported as errors. Other directives, and the
+// contents of their blocks, are ignored.
+//
+//     module github.com/user/proj
+//
+//     require github.com/pkg/errors v0.8.0
+//
+//     require (
+//             github.com/pkg/profile v1.2.1 // indirect
+//             gopkg.in/yaml.v2 v2.2.1
+//     )
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	sc := bufio.NewScanner(r)
+	var block string // directive of the enclosing block, if any
+	var lineno int
+	for sc.Scan() {
+		lineno++
+		args := fields(sc.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if args[0] == ")" {
+				block = ""
+				continue
+			}
+			if block == "require" {
+				req, err := parseRequire(args)
+				if err != nil {
+					return nil, fmt.Errorf("%d: %v", lineno, err)
+				}
+				f.Require = append(f.Require, req)
+			}
+			continue
+		}
+
+		switch verb, args := args[0], args[1:]; {
+		case verb == "replace", verb == "exclude":
+			return nil, fmt.Errorf("%d: %s directives are not supported", lineno, verb)
+		case len(args) == 1 && args[0] == "(":
+			block = verb
+		case verb == "module":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%d: module: expected module path", lineno)
+			}
+			path, err := unquote(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("%d: module: %v", lineno, err)
+			}
+			f.Module = path
+		case verb == "require":
+			req, err := parseRequire(args)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", lineno, err)
+			}
+			f.Require = append(f.Require, req)
+		}
+	}
+	if block != "" {
+		return nil, fmt.Errorf("%d: unterminated %s block", lineno, block)
+	}
+	return &f, sc.Err()
+}
+
+func parseRequire(args []string) (Require, error) {
+	if len(args) != 2 {
+		return Require{}, fmt.Errorf("require: expected module path and version, got %q", strings.Join(args, " "))
+	}
+	path, err := unquote(args[0])
+	if err != nil {
+		return Require{}, fmt.Errorf("require: %v", err)
+	}
+	version, err := unquote(args[1])
+	if err != nil {
+		return Require{}, fmt.Errorf("require: %v", err)
+	}
+	if !strings.HasPrefix(version, "v") {
+		return Require{}, fmt.Errorf("require %s: invalid version %q", path, version)
+	}
+	return Require{Path: path, Version: version}, nil
+}
+
+// fields splits line into whitespace separated fields, discarding any
+// trailing // comment.
+func fields(line string) []string {
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Fields(line)
+}
+
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) && !strings.HasPrefix(s, "`") {
+		return s, nil
+	}
+	return strconv.Unquote(s)
+}
+
+// EscapePath returns the form of the module path, or version, used for
+// directory names in the module cache. Upper case letters are replaced by an
+// exclamation mark followed by the lower case letter, so paths differing only
+// in case do not collide on case insensitive file systems.
+func EscapePath(path string) string {
+	var b bytes.Buffer
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// MajorVersion returns the major version suffix of the module path, such as
+// "v2" for github.com/user/lib/v2 or gopkg.in/yaml.v2, or "" for a path
+// without a suffix.
+func MajorVersion(path string) string {
+	i := strings.LastIndexAny(path, "/.")
+	if i < 0 || i+2 > len(path) || path[i+1] != 'v' {
+		return ""
+	}
+	n := path[i+2:]
+	if _, err := strconv.Atoi(n); err != nil || n == "" || n[0] == '0' {
+		return ""
+	}
+	if path[i] == '.' && !strings.HasPrefix(path, "gopkg.in/") {
+		return ""
+	}
+	return path[i+1:]
+}
+
+// CheckVersion returns an error if the major version of version does not
+// match the major version suffix of the module path; modules at v2 and
+// above must include the suffix, unless marked +incompatible.
+func CheckVersion(path, version string) error {
+	major := version
+	if i := strings.IndexAny(major, ".-+"); i >= 0 {
+		major = major[:i]
+	}
+	switch suffix := MajorVersion(path); {
+	case suffix == major:
+		return nil
+	case suffix == "" && (major == "v0" || major == "v1"):
+		return nil
+	case suffix == "" && strings.HasSuffix(version, "+incompatible"):
+		return nil
+	case strings.HasPrefix(path, "gopkg.in/") && suffix == "v1" && major == "v0":
+		return nil
+	default:
+		return errors.Errorf("%s %s: version does not match the major version of the module path", path, version)
+	}
+}
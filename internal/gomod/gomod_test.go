@@ -0,0 +1,131 @@
+package gomod
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want *File
+		err  string
+	}{{
+		src:  "module github.com/user/proj\n",
+		want: &File{Module: "github.com/user/proj"},
+	}, {
+		src: `module "github.com/user/proj"
+
+go 1.12
+
+require github.com/pkg/errors v0.8.0
+
+require (
+	github.com/pkg/profile v1.2.1 // indirect
+	// a comment
+	gopkg.in/yaml.v2 v2.2.1
+)
+`,
+		want: &File{
+			Module: "github.com/user/proj",
+			Require: []Require{
+				{"github.com/pkg/errors", "v0.8.0"},
+				{"github.com/pkg/profile", "v1.2.1"},
+				{"gopkg.in/yaml.v2", "v2.2.1"},
+			},
+		},
+	}, {
+		src: "require github.com/pkg/errors\n",
+		err: `1: require: expected module path and version, got "github.com/pkg/errors"`,
+	}, {
+		src: "require github.com/pkg/errors 0.8.0\n",
+		err: `1: require github.com/pkg/errors: invalid version "0.8.0"`,
+	}, {
+		src: "require (\n\tgithub.com/pkg/errors v0.8.0\n",
+		err: "2: unterminated require block",
+	}, {
+		src: "module github.com/user/proj\n\nreplace (\n\tgithub.com/a/b => ../b\n)\n",
+		err: "3: replace directives are not supported",
+	}, {
+		src: "module github.com/user/proj\n\nexclude github.com/c/d v1.0.0\n",
+		err: "3: exclude directives are not supported",
+	}}
+
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.src))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Parse(%q): got error %v, want %q", tt.src, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q): got %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"github.com/pkg/errors", "github.com/pkg/errors"},
+		{"github.com/Sirupsen/logrus", "github.com/!sirupsen/logrus"},
+		{"github.com/BurntSushi/toml", "github.com/!burnt!sushi/toml"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapePath(tt.path); got != tt.want {
+			t.Errorf("EscapePath(%q): got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMajorVersion(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"github.com/pkg/errors", ""},
+		{"github.com/user/lib/v2", "v2"},
+		{"github.com/user/lib/v10", "v10"},
+		{"github.com/user/lib/v0", ""},
+		{"github.com/user/lib/vfoo", ""},
+		{"gopkg.in/yaml.v2", "v2"},
+		{"github.com/user/lib.v2", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MajorVersion(tt.path); got != tt.want {
+			t.Errorf("MajorVersion(%q): got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		path, version string
+		ok            bool
+	}{
+		{"github.com/pkg/errors", "v0.8.0", true},
+		{"github.com/pkg/errors", "v1.0.0", true},
+		{"github.com/pkg/errors", "v2.0.0", false},
+		{"github.com/pkg/errors", "v2.0.0+incompatible", true},
+		{"github.com/user/lib/v2", "v2.1.0", true},
+		{"github.com/user/lib/v2", "v2.1.0-pre", true},
+		{"github.com/user/lib/v2", "v3.0.0", false},
+		{"github.com/user/lib/v2", "v1.0.0", false},
+		{"gopkg.in/yaml.v2", "v2.2.1", true},
+		{"gopkg.in/check.v1", "v0.0.0-20161208181325-20d25e280405", true},
+	}
+
+	for _, tt := range tests {
+		if err := CheckVersion(tt.path, tt.version); (err == nil) != tt.ok {
+			t.Errorf("CheckVersion(%q, %q): got %v, want ok: %v", tt.path, tt.version, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package semver parses SemVer 2.0.0 versions and the version constraints
+// used in depfiles.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a SemVer 2.0.0 version. Build metadata is discarded.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // pre-release, without the leading -
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Parse parses a version of the form MAJOR.MINOR.PATCH[-PRE][+BUILD].
+func Parse(s string) (Version, error) {
+	v, n, err := parse(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if n != 3 {
+		return Version{}, fmt.Errorf("%q is not a valid SemVer 2.0.0 version", s)
+	}
+	return v, nil
+}
+
+// parse parses a version which may be missing its minor and patch
+// numbers, returning the number of components present.
+func parse(s string) (Version, int, error) {
+	var v Version
+	invalid := fmt.Errorf("%q is not a valid SemVer 2.0.0 version", s)
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.Pre = s[:i], s[i+1:]
+		if v.Pre == "" {
+			return Version{}, 0, invalid
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, 0, invalid
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		if p == "" || (len(p) > 1 && p[0] == '0') {
+			return Version{}, 0, invalid
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, 0, invalid
+		}
+		*nums[i] = n
+	}
+	if v.Pre != "" && len(parts) != 3 {
+		return Version{}, 0, invalid
+	}
+	return v, len(parts), nil
+}
+
+// Compare returns -1, 0, or 1 as a is less than, equal to, or greater
+// than b, by SemVer precedence.
+func Compare(a, b Version) int {
+	switch {
+	case a.Major != b.Major:
+		return cmp(a.Major, b.Major)
+	case a.Minor != b.Minor:
+		return cmp(a.Minor, b.Minor)
+	case a.Patch != b.Patch:
+		return cmp(a.Patch, b.Patch)
+	}
+	// a version without a pre-release has higher precedence.
+	switch {
+	case a.Pre == b.Pre:
+		return 0
+	case a.Pre == "":
+		return 1
+	case b.Pre == "":
+		return -1
+	}
+	x, y := strings.Split(a.Pre, "."), strings.Split(b.Pre, ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if c := comparePre(x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp(len(x), len(y))
+}
+
+// comparePre compares pre-release identifiers; numeric identifiers are
+// compared numerically and sort before alphanumeric ones.
+func comparePre(a, b string) int {
+	m, errm := strconv.Atoi(a)
+	n, errn := strconv.Atoi(b)
+	switch {
+	case errm == nil && errn == nil:
+		return cmp(m, n)
+	case errm == nil:
+		return -1
+	case errn == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func cmp(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparator is a single term of a Constraint.
+type comparator struct {
+	op string // one of <, <=, >, >=, =
+	v  Version
+}
+
+func (c comparator) check(v Version) bool {
+	n := Compare(v, c.v)
+	switch c.op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	default:
+		return n == 0
+	}
+}
+
+// Constraint is a set of comparisons, all of which a version must satisfy.
+type Constraint struct {
+	s     string
+	terms []comparator
+	exact bool // the constraint names a single version
+}
+
+func (c *Constraint) String() string { return c.s }
+
+// ParseConstraint parses a constraint, a list of terms separated by commas
+// or spaces. Each term is one of
+//
+//	1.2.3		exactly 1.2.3
+//	1.2, 1.2.x	any 1.2 release, >=1.2.0 <1.3.0
+//	^1.2.3		compatible with 1.2.3, >=1.2.3 <2.0.0; ^0.2.3 is >=0.2.3 <0.3.0
+//	~1.2.3		patch releases of 1.2, >=1.2.3 <1.3.0; ~1 is >=1.0.0 <2.0.0
+//	>=1.2, >1.2, <=1.2, <1.2, =1.2
+//	*		any release
+//
+// Versions in a term may omit their minor and patch numbers. Pre-release
+// versions only satisfy constraints which name that exact version.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := Constraint{s: s}
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	for _, f := range fields {
+		terms, err := parseTerm(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %v", s, err)
+		}
+		c.terms = append(c.terms, terms...)
+	}
+	c.exact = len(c.terms) == 1 && c.terms[0].op == "="
+	return &c, nil
+}
+
+func parseTerm(s string) ([]comparator, error) {
+	if s == "*" || s == "x" {
+		return nil, nil
+	}
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op, s = prefix, s[len(prefix):]
+			break
+		}
+	}
+	s = strings.TrimPrefix(s, "v")
+	for strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".*") {
+		s = s[:len(s)-2]
+	}
+	v, n, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var next Version // the lowest version beyond those named by a partial v
+	switch n {
+	case 1:
+		next = Version{Major: v.Major + 1}
+	case 2:
+		next = Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		next = Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+
+	switch op {
+	case "", "=":
+		if n == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", next}}, nil
+	case ">=", "<":
+		return []comparator{{op, v}}, nil
+	case ">":
+		if n == 3 {
+			return []comparator{{">", v}}, nil
+		}
+		return []comparator{{">=", next}}, nil
+	case "<=":
+		if n == 3 {
+			return []comparator{{"<=", v}}, nil
+		}
+		return []comparator{{"<", next}}, nil
+	case "~":
+		if n == 1 {
+			return []comparator{{">=", v}, {"<", Version{Major: v.Major + 1}}}, nil
+		}
+		return []comparator{{">=", v}, {"<", Version{Major: v.Major, Minor: v.Minor + 1}}}, nil
+	default: // ^
+		var upper Version
+		switch {
+		case v.Major > 0 || n == 1:
+			upper = Version{Major: v.Major + 1}
+		case v.Minor > 0 || n == 2:
+			upper = Version{Minor: v.Minor + 1}
+		default:
+			upper = Version{Patch: v.Patch + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	}
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v Version) bool {
+	if v.Pre != "" && !c.exact {
+		return false
+	}
+	for _, t := range c.terms {
+		if !t.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Highest returns the highest of versions which satisfies the constraint.
+// Versions which are not valid are ignored.
+func (c *Constraint) Highest(versions []string) (string, bool) {
+	var best string
+	var bestv Version
+	for _, s := range versions {
+		v, err := Parse(s)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if best == "" || Compare(v, bestv) > 0 {
+			best, bestv = s, v
+		}
+	}
+	return best, best != ""
+}
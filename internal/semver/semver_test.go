@@ -0,0 +1,90 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"2.1.0", "2.0.9", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"1.0.0+build", "1.0.0", 0},
+	}
+
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Compare(a, b); got != tt.want {
+			t.Errorf("Compare(%q, %q): got %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "1", "1.2", "1.2.3.4", "01.2.3", "1.2.3-", "a.b.c", "-1.2.3"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): expected error", s)
+		}
+	}
+}
+
+func TestConstraintHighest(t *testing.T) {
+	versions := []string{"0.1.0", "0.1.5", "0.2.0", "1.0.0", "1.2.0", "1.2.7", "1.4.0", "1.4.3", "1.5.0", "2.0.0", "2.3.1", "3.0.0-beta.1", "3.0.0", "junk"}
+	tests := []struct {
+		c    string
+		want string
+	}{
+		{"^1.2.0", "1.5.0"},
+		{"^1.2", "1.5.0"},
+		{"^0.1.0", "0.1.5"},
+		{"^0.0.1", ""},
+		{"~1.4", "1.4.3"},
+		{"~1.2.3", "1.2.7"},
+		{"~1", "1.5.0"},
+		{">=2.0.0 <3", "2.3.1"},
+		{">=2.0.0,<3", "2.3.1"},
+		{">1.4", "3.0.0"},
+		{"<=1.4", "1.4.3"},
+		{"<1.4", "1.2.7"},
+		{"1.2", "1.2.7"},
+		{"1.2.x", "1.2.7"},
+		{"=1.2", "1.2.7"},
+		{"1.2.0", "1.2.0"},
+		{"3.0.0-beta.1", "3.0.0-beta.1"},
+		{"*", "3.0.0"},
+		{"^4", ""},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.c)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.c, err)
+			continue
+		}
+		got, _ := c.Highest(versions)
+		if got != tt.want {
+			t.Errorf("ParseConstraint(%q).Highest: got %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, s := range []string{"", "^", ">=a", "~1.2.3.4", "1.2-beta"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q): expected error", s)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package typecheck type checks gb packages from source.
+//
+// Imports are resolved through the *gb.Package graph, so the packages
+// visible to the type checker are those visible to the compiler: the
+// project, its vendor directory, the depfile cache and the standard
+// library, selected by the build constraints of the package's Context.
+package typecheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/constabulary/gb"
+)
+
+// Errors is the list of type errors found in a package.
+type Errors []error
+
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+	}
+}
+
+// A Loader type checks packages. Dependencies are type checked once, with
+// function bodies ignored, and shared between the packages checked by a
+// Loader. A Loader is safe for concurrent use, although checks are
+// serialised.
+type Loader struct {
+	Fset  *token.FileSet
+	Sizes types.Sizes // sizes of the target architecture, if not nil
+
+	mu   sync.Mutex
+	pkgs map[string]*types.Package // type checked dependencies, by import path
+}
+
+// NewLoader returns a Loader with an empty FileSet.
+func NewLoader() *Loader {
+	return &Loader{
+		Fset: token.NewFileSet(),
+		pkgs: make(map[string]*types.Package),
+	}
+}
+
+// Check parses and fully type checks the named files in the directory of
+// pkg as the package path, recording type information in info, which may
+// be nil. If there are type errors, Check returns an Errors value.
+func (l *Loader) Check(pkg *gb.Package, path string, names []string, info *types.Info) (*types.Package, []*ast.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files, err := l.parseFiles(pkg.Dir, names, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	var errs Errors
+	conf := types.Config{
+		FakeImportC: true,
+		Importer:    l.importer(pkg),
+		Sizes:       l.Sizes,
+		Error:       func(err error) { errs = append(errs, err) },
+	}
+	tp, _ := conf.Check(path, l.Fset, files, info)
+	if len(errs) > 0 {
+		return tp, files, errs
+	}
+	return tp, files, nil
+}
+
+// GoFiles returns the Go source files of pkg, excluding tests.
+func GoFiles(pkg *gb.Package) []string {
+	var files []string
+	files = append(files, pkg.GoFiles...)
+	files = append(files, pkg.CgoFiles...)
+	return files
+}
+
+// parseFiles parses the named files in dir.
+func (l *Loader) parseFiles(dir string, names []string, mode parser.Mode) ([]*ast.File, error) {
+	var files []*ast.File
+	for _, name := range names {
+		f, err := parser.ParseFile(l.Fset, filepath.Join(dir, name), nil, mode)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// importerFunc adapts a function to the types.Importer interface.
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// importer returns a types.Importer which resolves the raw import paths
+// found in the source of pkg.
+func (l *Loader) importer(pkg *gb.Package) types.Importer {
+	return importerFunc(func(path string) (*types.Package, error) {
+		if path == "unsafe" {
+			return types.Unsafe, nil
+		}
+		dep, err := resolveImport(pkg, path)
+		if err != nil {
+			return nil, err
+		}
+		return l.load(dep)
+	})
+}
+
+// resolveImport resolves the import path as written in the source of pkg to
+// a loaded package.
+func resolveImport(pkg *gb.Package, path string) (*gb.Package, error) {
+	for _, dep := range pkg.Imports {
+		// imports discovered via the standard library's vendor
+		// directory, or a nested vendor directory, are recorded
+		// with their vendored import path.
+		if dep.ImportPath == path || dep.ImportPath == "vendor/"+path || strings.HasSuffix(dep.ImportPath, "/vendor/"+path) {
+			return dep, nil
+		}
+	}
+	// test imports are not recorded in pkg.Imports.
+	return pkg.ResolvePackage(path)
+}
+
+// load returns the type checked exported API of pkg; function bodies are
+// not checked and errors are ignored as pkg is only a dependency.
+// The caller must hold l.mu.
+func (l *Loader) load(pkg *gb.Package) (*types.Package, error) {
+	if tp, ok := l.pkgs[pkg.ImportPath]; ok {
+		return tp, nil
+	}
+	files, err := l.parseFiles(pkg.Dir, GoFiles(pkg), 0)
+	if err != nil {
+		return nil, err
+	}
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Importer:         l.importer(pkg),
+		Sizes:            l.Sizes,
+		Error:            func(error) {},
+	}
+	tp, _ := conf.Check(pkg.ImportPath, l.Fset, files, nil)
+	l.pkgs[pkg.ImportPath] = tp
+	return tp, nil
+}
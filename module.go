@@ -0,0 +1,245 @@
+package gb
+
+import (
+	"archive/zip"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb/internal/gomod"
+	"github.com/pkg/errors"
+)
+
+// module is a required module version, served from the module cache.
+type module struct {
+	path, version string
+	dir           string // directory holding the contents of the module
+}
+
+// moduleImporter resolves packages inside required modules. Import paths
+// belong to the module with the longest matching path, so
+// github.com/user/lib/v2/pkg is found in github.com/user/lib/v2 rather
+// than github.com/user/lib.
+type moduleImporter struct {
+	Importer
+	*build.Context
+	modules []module // sorted by path, longest first
+}
+
+func (i *moduleImporter) Import(path string) (*build.Package, error) {
+	m, dir := i.lookup(path)
+	if m == nil {
+		return i.Importer.Import(path)
+	}
+	pkg, err := i.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg.ImportPath = path
+	pkg.Root = m.dir
+	pkg.SrcRoot = m.dir
+	return pkg, nil
+}
+
+// lookup returns the module providing path, and the directory of path
+// within it, or nil if no module contains path.
+func (i *moduleImporter) lookup(path string) (*module, string) {
+	for n := range i.modules {
+		m := &i.modules[n]
+		if path != m.path && !strings.HasPrefix(path, m.path+"/") {
+			continue
+		}
+		dir := filepath.Join(m.dir, filepath.FromSlash(strings.TrimPrefix(path[len(m.path):], "/")))
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return m, dir
+		}
+	}
+	return nil, ""
+}
+
+// addModuleDeps adds an importer above i for the modules required by
+// $PROJECT/go.mod and the depfile.
+func addModuleDeps(bc *build.Context, ctx *Context, i Importer) (Importer, error) {
+	versions := make(map[string]string)
+	for path, version := range ctx.depfileModules {
+		versions[path] = version
+	}
+	f, err := gomod.ParseFile(filepath.Join(ctx.Projectdir(), "go.mod"))
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		ctx.debug("no go.mod, nothing to do.")
+	case err != nil:
+		return nil, errors.Wrap(err, "could not parse go.mod")
+	default:
+		for _, req := range f.Require {
+			if v, ok := versions[req.Path]; ok && v != req.Version {
+				return nil, errors.Errorf("%s: go.mod requires %s, depfile requires %s", req.Path, req.Version, v)
+			}
+			versions[req.Path] = req.Version
+		}
+	}
+	if len(versions) == 0 {
+		return i, nil
+	}
+
+	var modules []module
+	for path, version := range versions {
+		if err := gomod.CheckVersion(path, version); err != nil {
+			return nil, err
+		}
+		dir, err := moduleDir(path, version)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, module{path: path, version: version, dir: dir})
+		ctx.debug("add importer for module %q: %v", path+"@"+version, dir)
+	}
+	sort.Sort(byModulePath(modules))
+	ctx.modules = modules
+	return &moduleImporter{
+		Importer: i,
+		Context:  bc,
+		modules:  modules,
+	}, nil
+}
+
+// byModulePath sorts modules by path, longest first.
+type byModulePath []module
+
+func (b byModulePath) Len() int      { return len(b) }
+func (b byModulePath) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byModulePath) Less(i, j int) bool {
+	if len(b[i].path) != len(b[j].path) {
+		return len(b[i].path) > len(b[j].path)
+	}
+	return b[i].path < b[j].path
+}
+
+// modCache returns the Go module cache; $GOMODCACHE, or pkg/mod in the first
+// $GOPATH entry.
+func modCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	list := filepath.SplitList(build.Default.GOPATH)
+	if len(list) == 0 || list[0] == "" {
+		return ""
+	}
+	return filepath.Join(list[0], "pkg", "mod")
+}
+
+// moduleDir returns the directory holding the contents of path@version.
+// The extracted module in the module cache is used if present, otherwise
+// the module zip, from the download cache of the module cache or
+// $GB_HOME/mod, is unpacked into $GB_HOME/mod. Modules are never fetched
+// from the network.
+func moduleDir(path, version string) (string, error) {
+	name := filepath.FromSlash(gomod.EscapePath(path) + "@" + gomod.EscapePath(version))
+	zipname := filepath.Join("cache", "download", filepath.FromSlash(gomod.EscapePath(path)), "@v", gomod.EscapePath(version)+".zip")
+	gbmod := filepath.Join(gbhome(), "mod")
+
+	var caches []string
+	if cache := modCache(); cache != "" {
+		caches = append(caches, cache)
+	}
+	caches = append(caches, gbmod)
+	for _, cache := range caches {
+		dir := filepath.Join(cache, name)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+	}
+	for _, cache := range caches {
+		zipfile := filepath.Join(cache, zipname)
+		if _, err := os.Stat(zipfile); err != nil {
+			continue
+		}
+		dir := filepath.Join(gbmod, name)
+		if err := unzipModule(dir, zipfile, path+"@"+version); err != nil {
+			return "", errors.Wrapf(err, "could not unpack %s", zipfile)
+		}
+		return dir, nil
+	}
+	return "", errors.Errorf("module %s@%s not found in the module cache; run 'go mod download %s@%s'", path, version, path, version)
+}
+
+// unzipModule extracts the module zip file to dest. If dest is created by
+// another process while the zip file is extracted, that copy is used.
+// Each file in a module zip is prefixed with path@version/.
+func unzipModule(dest, zipfile, prefix string) error {
+	r, err := zip.OpenReader(zipfile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := mkdir(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	tmpdir, err := ioutil.TempDir(filepath.Dir(dest), ".unzip")
+	if err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		name := strings.TrimPrefix(f.Name, prefix+"/")
+		if name == f.Name || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if clean := filepath.Clean(filepath.FromSlash(name)); filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+			os.RemoveAll(tmpdir)
+			return errors.Errorf("invalid file name %q", f.Name)
+		}
+		if err := unzipFile(filepath.Join(tmpdir, filepath.FromSlash(name)), f); err != nil {
+			os.RemoveAll(tmpdir)
+			return err
+		}
+	}
+	if err := os.Rename(tmpdir, dest); err != nil {
+		os.RemoveAll(tmpdir)
+		// another gb may have unpacked the same module concurrently.
+		if fi, serr := os.Stat(dest); serr == nil && fi.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func unzipFile(dst string, f *zip.File) error {
+	if err := mkdir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// isModule reports whether pkg was resolved from a module.
+func (pkg *Package) isModule() bool {
+	return pkg.isModuleRoot(pkg.Root)
+}
+
+// isModuleRoot reports whether dir is the directory of a required module.
+func (c *Context) isModuleRoot(dir string) bool {
+	for _, m := range c.modules {
+		if m.dir == dir {
+			return true
+		}
+	}
+	return false
+}
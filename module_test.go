@@ -0,0 +1,202 @@
+package gb
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeModuleZip writes a module zip for path@version containing files.
+func writeModuleZip(t *testing.T, file, path, version string, files map[string]string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, contents := range files {
+		fw, err := w.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModuleImporter(t *testing.T) {
+	cache := mktemp(t)
+	defer os.RemoveAll(cache)
+	gbhome := mktemp(t)
+	defer os.RemoveAll(gbhome)
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	defer os.Setenv("GB_HOME", os.Getenv("GB_HOME"))
+	os.Setenv("GOMODCACHE", cache)
+	os.Setenv("GB_HOME", gbhome)
+
+	mod := &testproject{t, project{rootdir: cache}}
+	mod.tempfile("github.com/!user/lib@v1.0.0/lib.go", "package lib\n\nconst V = 1\n")
+	mod.tempfile("github.com/!user/lib@v1.0.0/sub/sub.go", "package sub\n")
+	mod.tempfile("github.com/!user/lib/v2@v2.1.0/lib.go", "package lib\n\nconst V = 2\n")
+	writeModuleZip(t, filepath.Join(cache, "cache", "download", "example.com", "zipped", "@v", "v0.1.0.zip"), "example.com/zipped", "v0.1.0", map[string]string{
+		"zipped.go":      "package zipped\n",
+		"inner/inner.go": "package inner\n",
+	})
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("go.mod", `module example.com/proj
+
+require (
+	github.com/User/lib v1.0.0
+	github.com/User/lib/v2 v2.1.0
+)
+`)
+	proj.tempfile("depfile", "example.com/zipped module=v0.1.0\n")
+	proj.tempfile("src/app/app.go", `package app
+
+import (
+	_ "example.com/zipped/inner"
+	"github.com/User/lib"
+	_ "github.com/User/lib/sub"
+	libv2 "github.com/User/lib/v2"
+)
+
+const V = lib.V + libv2.V
+`)
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, dep := range pkg.Imports {
+		if origin := dep.Origin(); origin != "module" {
+			t.Errorf("%s: got origin %q, want %q", dep.ImportPath, origin, "module")
+		}
+		rel, err := filepath.Rel(dep.Root, dep.Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[dep.ImportPath] = filepath.ToSlash(filepath.Join(filepath.Base(dep.Root), rel))
+	}
+	want := map[string]string{
+		"example.com/zipped/inner": "zipped@v0.1.0/inner",
+		"github.com/User/lib":      "lib@v1.0.0",
+		"github.com/User/lib/sub":  "lib@v1.0.0/sub",
+		"github.com/User/lib/v2":   "v2@v2.1.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(gbhome, "mod", "example.com", "zipped@v0.1.0", "inner", "inner.go")); err != nil {
+		t.Fatalf("expected zipped module to be unpacked into $GB_HOME/mod: %v", err)
+	}
+}
+
+func TestModuleNotInCache(t *testing.T) {
+	cache := mktemp(t)
+	defer os.RemoveAll(cache)
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	os.Setenv("GOMODCACHE", cache)
+
+	tests := []struct {
+		gomod string
+		err   string
+	}{{
+		gomod: "require github.com/user/missing v1.0.0\n",
+		err:   "module github.com/user/missing@v1.0.0 not found in the module cache",
+	}, {
+		gomod: "require github.com/user/lib v2.0.0\n",
+		err:   "github.com/user/lib v2.0.0: version does not match the major version of the module path",
+	}, {
+		gomod: "require github.com/user/lib v1.0.0\nreplace github.com/user/lib => ../lib\n",
+		err:   "2: replace directives are not supported",
+	}}
+
+	for _, tt := range tests {
+		proj := tempProject(t)
+		defer os.RemoveAll(proj.rootdir)
+		proj.tempfile("go.mod", tt.gomod)
+		_, err := NewContext(proj)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("NewContext: got error %v, want %q", err, tt.err)
+		}
+	}
+}
+
+func TestUnzipModuleExists(t *testing.T) {
+	dir := mktemp(t)
+	defer os.RemoveAll(dir)
+	zipfile := filepath.Join(dir, "lib.zip")
+	writeModuleZip(t, zipfile, "github.com/user/lib", "v1.0.0", map[string]string{
+		"lib.go": "package lib\n",
+	})
+
+	// dest was unpacked by another gb while this one was extracting.
+	dest := filepath.Join(dir, "github.com", "user", "lib@v1.0.0")
+	if err := os.MkdirAll(filepath.Join(dest, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := unzipModule(dest, zipfile, "github.com/user/lib@v1.0.0"); err != nil {
+		t.Fatalf("unzipModule: %v", err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "github.com", "user", ".unzip*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("unzipModule: temporary directories left behind: %v", matches)
+	}
+}
+
+func TestModuleShadows(t *testing.T) {
+	cache := mktemp(t)
+	defer os.RemoveAll(cache)
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	os.Setenv("GOMODCACHE", cache)
+
+	mod := &testproject{t, project{rootdir: cache}}
+	mod.tempfile("github.com/user/lib@v1.0.0/lib.go", "package lib\n")
+	mod.tempfile("github.com/user/lib@v1.0.0/sub/sub.go", "package sub\n")
+
+	proj := tempProject(t)
+	defer os.RemoveAll(proj.rootdir)
+	proj.tempfile("go.mod", "require github.com/user/lib v1.0.0\n")
+	proj.tempfile("vendor/src/github.com/user/lib/lib.go", "package lib\n")
+
+	ctx, err := NewContext(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	moddir := filepath.Join(cache, "github.com", "user", "lib@v1.0.0")
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"github.com/user/lib", []string{filepath.Join(proj.rootdir, "vendor", "src", "github.com", "user", "lib"), moddir}},
+		{"github.com/user/lib/sub", []string{filepath.Join(moddir, "sub")}},
+		{"github.com/user/library", nil},
+	}
+	for _, tt := range tests {
+		if got := ctx.Shadows(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Shadows(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
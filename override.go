@@ -0,0 +1,148 @@
+package gb
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb/internal/depfile"
+	"github.com/pkg/errors"
+)
+
+// An override replaces the content of a depfile entry with a local
+// directory, for developing a dependency side by side with the project.
+type override struct {
+	prefix string
+	dir    string // the directory holding the package prefix
+}
+
+// overrideImporter resolves packages inside overridden depfile entries.
+// Import paths belong to the override with the longest matching prefix.
+type overrideImporter struct {
+	Importer
+	*build.Context
+	overrides []override // sorted by prefix, longest first
+}
+
+func (i *overrideImporter) Import(path string) (*build.Package, error) {
+	o, dir := lookupOverride(i.overrides, path)
+	if o == nil {
+		return i.Importer.Import(path)
+	}
+	pkg, err := i.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg.ImportPath = path
+	pkg.Root = o.dir
+	pkg.SrcRoot = o.dir
+	return pkg, nil
+}
+
+// lookupOverride returns the override providing path, and the directory of
+// path within it, or nil if no override contains path.
+func lookupOverride(overrides []override, path string) (*override, string) {
+	for n := range overrides {
+		o := &overrides[n]
+		if path != o.prefix && !strings.HasPrefix(path, o.prefix+"/") {
+			continue
+		}
+		dir := filepath.Join(o.dir, filepath.FromSlash(strings.TrimPrefix(path[len(o.prefix):], "/")))
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return o, dir
+		}
+	}
+	return nil, ""
+}
+
+// readOverrides returns the overrides named by path keys in the depfile df,
+// and by the entries of $PROJECT/depfile.local, which take precedence.
+// Relative paths are relative to the project directory.
+func readOverrides(ctx *Context, df map[string]map[string]string) ([]override, error) {
+	dirs := make(map[string]string)
+	for prefix, kv := range df {
+		if dir, ok := kv["path"]; ok {
+			dirs[prefix] = dir
+		}
+	}
+	local, err := depfile.ParseFile(filepath.Join(ctx.Projectdir(), "depfile.local"))
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		ctx.debug("no depfile.local, nothing to do.")
+	case err != nil:
+		return nil, errors.Wrap(err, "could not parse depfile.local")
+	}
+	for prefix, kv := range local {
+		dir, ok := kv["path"]
+		if !ok || len(kv) != 1 {
+			return nil, errors.Errorf("depfile.local: %s: expected a single path key", prefix)
+		}
+		dirs[prefix] = dir
+	}
+
+	var overrides []override
+	for prefix, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(ctx.Projectdir(), filepath.FromSlash(dir))
+		}
+		dir = filepath.Clean(dir)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, errors.Errorf("%s: path %s is not a directory", prefix, dir)
+		}
+		overrides = append(overrides, override{prefix: prefix, dir: dir})
+		ctx.debug("add override for %q: %v", prefix, dir)
+	}
+	sort.Sort(byOverridePrefix(overrides))
+	return overrides, nil
+}
+
+// byOverridePrefix sorts overrides by prefix, longest first.
+type byOverridePrefix []override
+
+func (b byOverridePrefix) Len() int      { return len(b) }
+func (b byOverridePrefix) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byOverridePrefix) Less(i, j int) bool {
+	if len(b[i].prefix) != len(b[j].prefix) {
+		return len(b[i].prefix) > len(b[j].prefix)
+	}
+	return b[i].prefix < b[j].prefix
+}
+
+// Overrides returns the depfile entries replaced by local directories, by
+// path keys in the depfile or by $PROJECT/depfile.local, mapped to the
+// directory replacing each.
+func (c *Context) Overrides() map[string]string {
+	m := make(map[string]string)
+	for _, o := range c.overrides {
+		m[o.prefix] = o.dir
+	}
+	return m
+}
+
+// override returns the override for prefix, if any.
+func (c *Context) override(prefix string) *override {
+	for n := range c.overrides {
+		if c.overrides[n].prefix == prefix {
+			return &c.overrides[n]
+		}
+	}
+	return nil
+}
+
+// isOverride reports whether pkg was resolved from an overridden depfile
+// entry.
+func (pkg *Package) isOverride() bool {
+	return pkg.isOverrideRoot(pkg.Root)
+}
+
+// isOverrideRoot reports whether dir is the directory of an override.
+func (c *Context) isOverrideRoot(dir string) bool {
+	for _, o := range c.overrides {
+		if o.dir == dir {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package gb
 
 import (
+	"bytes"
 	"fmt"
 	"go/build"
 	"os"
@@ -20,6 +21,8 @@ type Package struct {
 	NotStale  bool // this package _and_ all its dependencies are not stale
 	Main      bool // is this a command
 	Imports   []*Package
+
+	actionKey string // memoised result of ActionKey
 }
 
 // newPackage creates a resolved Package without setting pkg.Stale.
@@ -38,6 +41,31 @@ func (ctx *Context) newPackage(p *build.Package) (*Package, error) {
 	return pkg, nil
 }
 
+// Origin reports where pkg was resolved from; "std" for the standard library,
+// "project" for $PROJECT/src, "vendor" for $PROJECT/vendor/src, "gopath" for
+// $GOPATH, "module" for the module cache, "override" for depfile entries
+// replaced by a local directory, or "depfile" for packages fetched into the
+// depfile cache.
+func (pkg *Package) Origin() string {
+	switch {
+	case pkg.Goroot:
+		return "std"
+	case pkg.Root == "", pkg.Root == pkg.Projectdir():
+		// synthesised packages, such as tests, belong to the project.
+		return "project"
+	case pkg.Root == filepath.Join(pkg.Projectdir(), "vendor"):
+		return "vendor"
+	case pkg.isGopath():
+		return "gopath"
+	case pkg.isModule():
+		return "module"
+	case pkg.isOverride():
+		return "override"
+	default:
+		return "depfile"
+	}
+}
+
 func (p *Package) String() string {
 	return fmt.Sprintf("%s {Name:%s, Dir:%s}", p.ImportPath, p.Name, p.Dir)
 }
@@ -73,7 +101,37 @@ func (p *Package) complete() bool {
 }
 
 // Binfile returns the destination of the compiled target of this command.
+// If the Context's binary name template fails for this command, Binfile
+// returns the destination the binary would have without the template, and
+// linking the command reports the error.
 func (pkg *Package) Binfile() string {
+	if file, err := pkg.binfile(); err == nil {
+		return file
+	}
+	return pkg.defaultBinfile()
+}
+
+// binfile returns the destination of the compiled target of this command,
+// or an error if the Context's binary name template fails for it.
+func (pkg *Package) binfile() (string, error) {
+	if !pkg.TestScope {
+		switch {
+		case pkg.outfile != "":
+			return pkg.outfile, nil
+		case pkg.bintemplate != nil:
+			name, err := pkg.templateBinname()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(pkg.bindir(), name), nil
+		}
+	}
+	return pkg.defaultBinfile(), nil
+}
+
+// defaultBinfile returns the destination of the compiled target of this
+// command, named after the last element of its import path.
+func (pkg *Package) defaultBinfile() string {
 	target := filepath.Join(pkg.bindir(), pkg.binname())
 
 	// if this is a cross compile or GOOS/GOARCH are both defined or there are build tags, add ctxString.
@@ -93,6 +151,8 @@ func (pkg *Package) bindir() string {
 	switch {
 	case pkg.TestScope:
 		return filepath.Join(pkg.Context.Workdir(), filepath.FromSlash(pkg.ImportPath), "_test")
+	case pkg.outdir != "":
+		return pkg.outdir
 	default:
 		return pkg.Context.bindir()
 	}
@@ -132,6 +192,27 @@ func (pkg *Package) binname() string {
 	return filepath.Base(filepath.FromSlash(pkg.ImportPath))
 }
 
+// templateBinname returns the name of the binary produced by the Context's
+// binary name template.
+func (pkg *Package) templateBinname() (string, error) {
+	data := BinNameData{
+		Name:       pkg.binname(),
+		ImportPath: pkg.ImportPath,
+		GOOS:       pkg.gotargetos,
+		GOARCH:     pkg.gotargetarch,
+		Tags:       strings.Join(pkg.buildtags, "-"),
+	}
+	if pkg.gotargetos == "windows" {
+		data.Ext = ".exe"
+	}
+	var buf bytes.Buffer
+	if err := pkg.bintemplate.Execute(&buf, data); err != nil {
+		// BinName only checked the template against a zero BinNameData.
+		return "", errors.Wrapf(err, "%s: binary name template", pkg.ImportPath)
+	}
+	return buf.String(), nil
+}
+
 // installpath returns the distination to cache this package's compiled .a file.
 // pkgpath and installpath differ in that the former returns the location where you will find
 // a previously cached .a file, the latter returns the location where an installed file
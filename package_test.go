@@ -3,6 +3,7 @@ package gb
 import (
 	"fmt"
 	"go/build"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -102,6 +103,77 @@ func TestPackageBinfile(t *testing.T) {
 	}
 }
 
+func TestPackageBinfileOutput(t *testing.T) {
+	opts := func(o ...func(*Context) error) []func(*Context) error { return o }
+	dir, err := ioutil.TempDir("", "gb-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var tests = []struct {
+		opts []func(*Context) error
+		want string // binfile result
+	}{{
+		opts: opts(Output(filepath.Join(dir, "prog"))),
+		want: filepath.Join(dir, "prog"),
+	}, {
+		opts: opts(Output(dir)),
+		want: filepath.Join(dir, "b"),
+	}, {
+		opts: opts(Output(filepath.Join(dir, "out") + string(filepath.Separator)), Tags("lol")),
+		want: filepath.Join(dir, "out", "b-lol"),
+	}, {
+		opts: opts(Output(dir), BinName("{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}"), GOOS("windows")),
+		want: filepath.Join(dir, fmt.Sprintf("b-windows-%s.exe", runtime.GOARCH)),
+	}, {
+		opts: opts(Output(filepath.Join(dir, "prog")), BinName("{{.Name}}-x")),
+		want: filepath.Join(dir, "prog"),
+	}}
+
+	proj := testProject(t)
+	for i, tt := range tests {
+		ctx, err := NewContext(proj, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Destroy()
+		pkg, err := ctx.ResolvePackage("b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pkg.Binfile(); got != tt.want {
+			t.Errorf("test %v: (%s).Binfile(): want %s, got %s", i+1, pkg.ImportPath, tt.want, got)
+		}
+	}
+}
+
+func TestBinNameInvalid(t *testing.T) {
+	for _, tmpl := range []string{"{{.Name", "{{.Nope}}"} {
+		if err := BinName(tmpl)(new(Context)); err == nil {
+			t.Errorf("BinName(%q): expected error", tmpl)
+		}
+	}
+}
+
+func TestBinNameExecuteError(t *testing.T) {
+	// the template only fails with the data of a real package.
+	ctx, err := NewContext(testProject(t), BinName(`{{if .GOOS}}{{index .Name 99}}{{end}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	pkg, err := ctx.ResolvePackage("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkg.binfile(); err == nil {
+		t.Fatal("binfile: expected error")
+	}
+	if got, want := pkg.Binfile(), pkg.defaultBinfile(); got != want {
+		t.Errorf("Binfile: got %s, want %s", got, want)
+	}
+}
+
 func TestPackageBindir(t *testing.T) {
 	ctx := testContext(t)
 	defer ctx.Destroy()
@@ -134,6 +206,29 @@ func TestPackageBindir(t *testing.T) {
 	}
 }
 
+func TestPackageOrigin(t *testing.T) {
+	ctx := testContext(t)
+	defer ctx.Destroy()
+	tests := []struct {
+		pkg  string
+		want string
+	}{
+		{"a", "project"},
+		{"nesteddep", "vendor"},
+		{"fmt", "std"},
+		{"unsafe", "std"},
+	}
+	for _, tt := range tests {
+		pkg, err := ctx.ResolvePackage(tt.pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pkg.Origin(); got != tt.want {
+			t.Errorf("(%s).Origin(): want %q, got %q", tt.pkg, tt.want, got)
+		}
+	}
+}
+
 func TestNewPackage(t *testing.T) {
 	tests := []struct {
 		pkg  build.Package
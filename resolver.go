@@ -103,6 +103,10 @@ func (i *importer) Import(path string) (*build.Package, error) {
 		}
 		p = pkg
 		p.ImportPath = importpath
+		// record the root the package was found in, so callers can
+		// tell project, vendored and standard library packages apart.
+		p.Root = i.Root
+		p.SrcRoot = filepath.Join(i.Root, "src")
 		return nil
 	}
 
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/constabulary/gb"
+)
+
+// testKey returns the key under which the output of a successful run of
+// the tests in testpkg, and xtestpkg if not nil, with flags is stored.
+func testKey(testpkg, xtestpkg *gb.Package, flags []string) (string, error) {
+	h := sha256.New()
+	for _, p := range []*gb.Package{testpkg, xtestpkg} {
+		if p == nil {
+			continue
+		}
+		key, err := p.ActionKey()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "test %s %s\n", p.ImportPath, key)
+	}
+	fmt.Fprintf(h, "flags %q\n", flags)
+
+	// tests frequently read fixtures from testdata, so include its
+	// contents in the key.
+	testdata := filepath.Join(testpkg.Dir, "testdata")
+	err := filepath.Walk(testdata, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == testdata {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(testdata, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "testdata %s %d\n", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// cachedTest replays the output of a previous successful run of the tests
+// of pkg, reporting whether it was present in the cache, and returns the key
+// under which the output of this run is stored. If the Context has no cache,
+// cachedTest returns an empty key.
+func cachedTest(pkg, testpkg, xtestpkg *gb.Package, flags []string) (string, bool) {
+	cache := pkg.Cache()
+	if cache == nil || pkg.Nope {
+		return "", false
+	}
+	key, err := testKey(testpkg, xtestpkg, flags)
+	if err != nil {
+		pkg.Debug("cache: %s: %v", pkg.ImportPath, err)
+		return "", false
+	}
+	rc, err := cache.Get(key)
+	if err != nil {
+		pkg.Debug("cache: miss test %s: %v", pkg.ImportPath, err)
+		return key, false
+	}
+	defer rc.Close()
+	output, err := ioutil.ReadAll(rc)
+	if err != nil {
+		pkg.Debug("cache: test %s: %v", pkg.ImportPath, err)
+		return key, false
+	}
+	fmt.Printf("%s (cached)\n", pkg.ImportPath)
+	if pkg.Verbose {
+		os.Stdout.Write(output)
+	}
+	return key, true
+}
+
+// storeTest stores the output of a successful test run in the cache.
+func storeTest(pkg *gb.Package, key string, output []byte) {
+	if err := pkg.Cache().Put(key, bytes.NewReader(output)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: unable to store test result for %s in cache: %v\n", pkg.ImportPath, err)
+	}
+}
@@ -115,6 +115,20 @@ func TestPackage(targets map[string]*gb.Action, pkg *gb.Package, flags []string)
 	}
 	testpkg.TestScope = true
 
+	var xtestpkg *gb.Package
+	if len(pkg.XTestGoFiles) > 0 {
+		xtestpkg, err = pkg.NewPackage(&build.Package{
+			Name:       name,
+			ImportPath: pkg.ImportPath + "_test",
+			GoFiles:    pkg.XTestGoFiles,
+			Imports:    pkg.XTestImports,
+			Dir:        pkg.Dir,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// only build the internal test if there is Go source or
 	// internal test files.
 	var testobj *gb.Action
@@ -133,18 +147,7 @@ func TestPackage(targets map[string]*gb.Action, pkg *gb.Package, flags []string)
 	}
 
 	// external tests
-	if len(pkg.XTestGoFiles) > 0 {
-		xtestpkg, err := pkg.NewPackage(&build.Package{
-			Name:       name,
-			ImportPath: pkg.ImportPath + "_test",
-			GoFiles:    pkg.XTestGoFiles,
-			Imports:    pkg.XTestImports,
-			Dir:        pkg.Dir,
-		})
-		if err != nil {
-			return nil, err
-		}
-
+	if xtestpkg != nil {
 		// build external test dependencies
 		deps, err := gb.BuildDependencies(targets, xtestpkg)
 		if err != nil {
@@ -183,6 +186,14 @@ func TestPackage(targets map[string]*gb.Action, pkg *gb.Package, flags []string)
 			// To solve this, we merge the testmain compile step (which includes
 			// linking) and the test run and cleanup steps so they are executed
 			// as one atomic operation.
+			//
+			// If the result of a previous run of these tests is present
+			// in the cache, replay it rather than linking and running
+			// the tests.
+			key, cached := cachedTest(pkg, testpkg, xtestpkg, flags)
+			if cached {
+				return nil
+			}
 			var output bytes.Buffer
 			err := testmain.Run() // compile and link
 			if err == nil {
@@ -195,6 +206,9 @@ func TestPackage(targets map[string]*gb.Action, pkg *gb.Package, flags []string)
 					pkg.Debug("%s", cmd.Args)
 					err = cmd.Run()                         // run test
 					err = errors.Wrapf(err, "%s", cmd.Args) // wrap error if failed
+					if err == nil && key != "" {
+						storeTest(pkg, key, output.Bytes())
+					}
 				}
 
 				// test binaries can be very large, so always unlink the
@@ -0,0 +1,5 @@
+package internalbad
+
+import "internals/internal/x"
+
+const B = x.X
@@ -0,0 +1,5 @@
+package a
+
+import "internals/internal/x"
+
+const A = x.X
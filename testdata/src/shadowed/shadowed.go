@@ -0,0 +1,3 @@
+package shadowed
+
+const Origin = "project"
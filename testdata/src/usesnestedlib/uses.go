@@ -0,0 +1,8 @@
+package usesnestedlib
+
+import (
+	"nesteddep"
+	"nestedlib"
+)
+
+const V = nestedlib.V + nesteddep.V
@@ -0,0 +1,5 @@
+package usesshadowed
+
+import "shadowed"
+
+const V = shadowed.Origin
@@ -0,0 +1,179 @@
+package vet
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/internal/typecheck"
+	"github.com/pkg/errors"
+)
+
+// A checker inspects a type checked package and reports problems.
+type checker struct {
+	name string
+	run  func(*pass)
+}
+
+// checkers are the checks run by vet, in order.
+var checkers = []checker{
+	{"assign", checkAssign},
+	{"atomic", checkAtomic},
+	{"composites", checkComposites},
+	{"copylocks", checkCopyLocks},
+	{"nilfunc", checkNilFunc},
+	{"printf", checkPrintf},
+	{"structtag", checkStructTags},
+	{"unreachable", checkUnreachable},
+	{"unusedresult", checkUnusedResult},
+}
+
+// pass holds the state of a type checked package while it is checked.
+type pass struct {
+	fset  *token.FileSet
+	files []*ast.File
+	pkg   *types.Package
+	info  *types.Info
+
+	check string // name of the running check
+	diags []Diagnostic
+}
+
+// newPass type checks the named files of pkg as the package path.
+func newPass(l *typecheck.Loader, pkg *gb.Package, path string, names []string) (*pass, error) {
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	tp, files, err := l.Check(pkg, path, names, info)
+	if err != nil {
+		return nil, errors.Wrapf(err, "typecheck %s", path)
+	}
+	return &pass{
+		fset:  l.Fset,
+		files: files,
+		pkg:   tp,
+		info:  info,
+	}, nil
+}
+
+// run runs each checker over the package and returns any problems found.
+func (p *pass) run() []Diagnostic {
+	for _, c := range checkers {
+		p.check = c.name
+		c.run(p)
+	}
+	return p.diags
+}
+
+// reportf records a problem at pos.
+func (p *pass) reportf(pos token.Pos, format string, args ...interface{}) {
+	p.diags = append(p.diags, Diagnostic{
+		Pos:     p.fset.Position(pos),
+		Check:   p.check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// inspect calls fn for each node in each file of the package.
+func (p *pass) inspect(fn func(ast.Node) bool) {
+	for _, f := range p.files {
+		ast.Inspect(f, fn)
+	}
+}
+
+// typeOf returns the type of e, or nil if unknown.
+func (p *pass) typeOf(e ast.Expr) types.Type {
+	return p.info.TypeOf(e)
+}
+
+// callee returns the function called by call, or nil if call is not a
+// call to a statically known function or method.
+func (p *pass) callee(call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fn := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fn
+	case *ast.SelectorExpr:
+		if sel, ok := p.info.Selections[fn]; ok {
+			f, _ := sel.Obj().(*types.Func)
+			return f
+		}
+		id = fn.Sel
+	default:
+		return nil
+	}
+	f, _ := p.info.Uses[id].(*types.Func)
+	return f
+}
+
+// funcName returns the qualified name of f, in the form pkg.Func or
+// (pkg.Type).Method for methods.
+func funcName(f *types.Func) string {
+	if f == nil {
+		return ""
+	}
+	sig := f.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		t := recv.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil {
+			return fmt.Sprintf("(%s.%s).%s", named.Obj().Pkg().Path(), named.Obj().Name(), f.Name())
+		}
+		return f.Name()
+	}
+	if f.Pkg() == nil {
+		return f.Name()
+	}
+	return f.Pkg().Path() + "." + f.Name()
+}
+
+// unparen returns e with any enclosing parentheses removed.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// render returns the source form of e.
+func render(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, e)
+	return buf.String()
+}
+
+// sameExpr reports whether x and y are the same side effect free
+// expression, such as a variable, field or constant index.
+func sameExpr(x, y ast.Expr) bool {
+	x, y = unparen(x), unparen(y)
+	switch x := x.(type) {
+	case *ast.Ident:
+		y, ok := y.(*ast.Ident)
+		return ok && x.Name == y.Name && x.Name != "_"
+	case *ast.SelectorExpr:
+		y, ok := y.(*ast.SelectorExpr)
+		return ok && x.Sel.Name == y.Sel.Name && sameExpr(x.X, y.X)
+	case *ast.IndexExpr:
+		y, ok := y.(*ast.IndexExpr)
+		return ok && sameExpr(x.X, y.X) && sameExpr(x.Index, y.Index)
+	case *ast.StarExpr:
+		y, ok := y.(*ast.StarExpr)
+		return ok && sameExpr(x.X, y.X)
+	case *ast.BasicLit:
+		y, ok := y.(*ast.BasicLit)
+		return ok && x.Kind == y.Kind && x.Value == y.Value
+	}
+	return false
+}
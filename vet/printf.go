@@ -0,0 +1,276 @@
+package vet
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+	"unicode/utf8"
+)
+
+// printfFuncs maps the names of printf style functions to the index of
+// their format argument.
+var printfFuncs = map[string]int{
+	"fmt.Errorf":                         0,
+	"fmt.Fprintf":                        1,
+	"fmt.Printf":                         0,
+	"fmt.Sprintf":                        0,
+	"log.Fatalf":                         0,
+	"log.Panicf":                         0,
+	"log.Printf":                         0,
+	"(log.Logger).Fatalf":                0,
+	"(log.Logger).Panicf":                0,
+	"(log.Logger).Printf":                0,
+	"(testing.common).Errorf":            0,
+	"(testing.common).Fatalf":            0,
+	"(testing.common).Logf":              0,
+	"(testing.common).Skipf":             0,
+	"github.com/pkg/errors.Errorf":       0,
+	"github.com/pkg/errors.Wrapf":        1,
+	"github.com/pkg/errors.WithMessagef": 1,
+}
+
+// printFuncs are the names of print style functions, which should not be
+// passed format directives.
+var printFuncs = map[string]bool{
+	"fmt.Fprint":             true,
+	"fmt.Fprintln":           true,
+	"fmt.Print":              true,
+	"fmt.Println":            true,
+	"fmt.Sprint":             true,
+	"fmt.Sprintln":           true,
+	"log.Fatal":              true,
+	"log.Fatalln":            true,
+	"log.Panic":              true,
+	"log.Panicln":            true,
+	"log.Print":              true,
+	"log.Println":            true,
+	"(log.Logger).Fatal":     true,
+	"(log.Logger).Fatalln":   true,
+	"(log.Logger).Panic":     true,
+	"(log.Logger).Panicln":   true,
+	"(log.Logger).Print":     true,
+	"(log.Logger).Println":   true,
+	"(testing.common).Error": true,
+	"(testing.common).Fatal": true,
+	"(testing.common).Log":   true,
+	"(testing.common).Skip":  true,
+}
+
+// checkPrintf reports printf style calls whose format string does not match
+// their arguments, and print style calls which appear to contain a format.
+func checkPrintf(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		name := funcName(p.callee(call))
+		if i, ok := printfFuncs[name]; ok {
+			checkPrintfCall(p, call, name, i)
+		} else if printFuncs[name] {
+			checkPrintCall(p, call, name)
+		}
+		return true
+	})
+}
+
+// shortName returns the unqualified name of a printf style function.
+func shortName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// constString returns the value of e if it is a constant string.
+func constString(p *pass, e ast.Expr) (string, bool) {
+	tv, ok := p.info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+func checkPrintfCall(p *pass, call *ast.CallExpr, name string, idx int) {
+	if idx >= len(call.Args) || call.Ellipsis.IsValid() {
+		return
+	}
+	format, ok := constString(p, call.Args[idx])
+	if !ok {
+		return
+	}
+	args := call.Args[idx+1:]
+	fn := shortName(name)
+	argn := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		// flags, width and precision.
+		for i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0 {
+			if format[i] == '*' {
+				argn++
+			}
+			if format[i] == '[' {
+				// explicit argument indexes are not checked.
+				return
+			}
+			i++
+		}
+		if i >= len(format) {
+			p.reportf(call.Pos(), "%s format %s is missing verb at end of string", fn, format)
+			return
+		}
+		verb, w := utf8.DecodeRuneInString(format[i:])
+		i += w - 1
+		if verb == '%' {
+			continue
+		}
+		if !strings.ContainsRune("bcdeEfFgGopqstTUvwxX", verb) {
+			p.reportf(call.Pos(), "%s format %%%c has unknown verb %c", fn, verb, verb)
+			return
+		}
+		if verb == 'w' && name != "fmt.Errorf" {
+			p.reportf(call.Pos(), "%s does not support error-wrapping directive %%w", fn)
+			return
+		}
+		if argn >= len(args) {
+			p.reportf(call.Pos(), "%s format %%%c reads arg #%d, but call has %d arg(s)", fn, verb, argn+1, len(args))
+			return
+		}
+		if !matchVerb(p.typeOf(args[argn]), verb) {
+			p.reportf(call.Pos(), "%s format %%%c has arg %s of wrong type %s", fn, verb, render(p.fset, args[argn]), p.typeOf(args[argn]))
+		}
+		argn++
+	}
+	if argn < len(args) {
+		p.reportf(call.Pos(), "%s call needs %d arg(s) but has %d arg(s)", fn, argn, len(args))
+	}
+}
+
+func checkPrintCall(p *pass, call *ast.CallExpr, name string) {
+	if len(call.Args) == 0 {
+		return
+	}
+	fn := shortName(name)
+	// the first argument of Fprint is the writer.
+	first := 0
+	if strings.HasPrefix(fn, "Fprint") {
+		first = 1
+	}
+	if first >= len(call.Args) {
+		return
+	}
+	if s, ok := constString(p, call.Args[first]); ok && hasFormatVerb(s) {
+		p.reportf(call.Pos(), "%s call has possible formatting directive %s", fn, s)
+	}
+	if strings.HasSuffix(fn, "ln") {
+		last := call.Args[len(call.Args)-1]
+		if s, ok := constString(p, last); ok && strings.HasSuffix(s, "\n") {
+			p.reportf(call.Pos(), "%s arg list ends with redundant newline", fn)
+		}
+	}
+}
+
+// hasFormatVerb reports whether s appears to contain a printf verb.
+func hasFormatVerb(s string) bool {
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '%' && strings.IndexByte("dsvqxXtfg", s[i+1]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// errorType is the predeclared error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// matchVerb reports whether a value of type t may be formatted with verb.
+// Unknown types, interfaces and types implementing fmt.Formatter always match,
+// other than for %w, which requires an error.
+func matchVerb(t types.Type, verb rune) bool {
+	if verb == 'w' {
+		return t == nil || types.Implements(t, errorType)
+	}
+	return matchType(t, verb, make(map[types.Type]bool))
+}
+
+// matchType implements matchVerb; seen guards against recursive types.
+func matchType(t types.Type, verb rune, seen map[types.Type]bool) bool {
+	if t == nil || seen[t] || verb == 'v' || verb == 'T' {
+		return true
+	}
+	seen[t] = true
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		return true
+	}
+	if hasMethod(t, "Format") {
+		return true
+	}
+	if verb == 'p' {
+		switch t.Underlying().(type) {
+		case *types.Pointer, *types.Map, *types.Chan, *types.Slice, *types.Signature:
+			return true
+		}
+		return false
+	}
+	if verb == 's' || verb == 'q' {
+		if hasMethod(t, "Error") || hasMethod(t, "String") {
+			return true
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return matchBasic(u, verb)
+	case *types.Pointer:
+		// pointers to structs, arrays, slices and maps print their
+		// contents; other pointers print as addresses.
+		switch u.Elem().Underlying().(type) {
+		case *types.Struct, *types.Array, *types.Slice, *types.Map:
+			return matchType(u.Elem(), verb, seen)
+		}
+		return strings.ContainsRune("bdoxX", verb)
+	case *types.Slice:
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Byte && strings.ContainsRune("sqxX", verb) {
+			return true
+		}
+		return matchType(u.Elem(), verb, seen)
+	case *types.Array:
+		return matchType(u.Elem(), verb, seen)
+	case *types.Map:
+		return matchType(u.Key(), verb, seen) && matchType(u.Elem(), verb, seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if !matchType(u.Field(i).Type(), verb, seen) {
+				return false
+			}
+		}
+		return true
+	case *types.Chan, *types.Signature:
+		return strings.ContainsRune("bdoxX", verb)
+	}
+	return true
+}
+
+func matchBasic(b *types.Basic, verb rune) bool {
+	info := b.Info()
+	switch {
+	case info&types.IsBoolean != 0:
+		return verb == 't'
+	case info&types.IsInteger != 0:
+		return strings.ContainsRune("bcdoqxXU", verb)
+	case info&types.IsFloat != 0, info&types.IsComplex != 0:
+		return strings.ContainsRune("beEfFgGxX", verb)
+	case info&types.IsString != 0:
+		return strings.ContainsRune("sqxX", verb)
+	case b.Kind() == types.UnsafePointer:
+		return strings.ContainsRune("bdoxX", verb)
+	}
+	return true
+}
+
+// hasMethod reports whether t, or a pointer to t, has a method named name.
+func hasMethod(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
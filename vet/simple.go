@@ -0,0 +1,211 @@
+package vet
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// checkAssign reports assignments of a variable to itself, x = x.
+func checkAssign(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		stmt, ok := n.(*ast.AssignStmt)
+		if !ok || stmt.Tok != token.ASSIGN || len(stmt.Lhs) != len(stmt.Rhs) {
+			return true
+		}
+		for i, lhs := range stmt.Lhs {
+			if sameExpr(lhs, stmt.Rhs[i]) {
+				p.reportf(stmt.Pos(), "self-assignment of %s to %s", render(p.fset, stmt.Rhs[i]), render(p.fset, lhs))
+			}
+		}
+		return true
+	})
+}
+
+// checkAtomic reports assignments of the result of an atomic operation to
+// the variable being operated on, x = atomic.AddInt64(&x, 1).
+func checkAtomic(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		stmt, ok := n.(*ast.AssignStmt)
+		if !ok || len(stmt.Lhs) != len(stmt.Rhs) {
+			return true
+		}
+		for i, rhs := range stmt.Rhs {
+			call, ok := unparen(rhs).(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				continue
+			}
+			f := p.callee(call)
+			if f == nil || f.Pkg() == nil || f.Pkg().Path() != "sync/atomic" {
+				continue
+			}
+			switch f.Name() {
+			case "AddInt32", "AddInt64", "AddUint32", "AddUint64", "AddUintptr":
+			default:
+				continue
+			}
+			addr, ok := unparen(call.Args[0]).(*ast.UnaryExpr)
+			if ok && addr.Op == token.AND && sameExpr(addr.X, stmt.Lhs[i]) {
+				p.reportf(stmt.Pos(), "direct assignment to atomic value")
+			}
+		}
+		return true
+	})
+}
+
+// checkNilFunc reports comparisons of functions, which are never nil,
+// against nil.
+func checkNilFunc(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		e, ok := n.(*ast.BinaryExpr)
+		if !ok || (e.Op != token.EQL && e.Op != token.NEQ) {
+			return true
+		}
+		var x ast.Expr
+		switch {
+		case isNil(p, e.X):
+			x = e.Y
+		case isNil(p, e.Y):
+			x = e.X
+		default:
+			return true
+		}
+		var id *ast.Ident
+		switch x := unparen(x).(type) {
+		case *ast.Ident:
+			id = x
+		case *ast.SelectorExpr:
+			id = x.Sel
+		default:
+			return true
+		}
+		if f, ok := p.info.Uses[id].(*types.Func); ok {
+			p.reportf(e.Pos(), "comparison of function %s %s nil is always %v", f.Name(), e.Op, e.Op == token.NEQ)
+		}
+		return true
+	})
+}
+
+// isNil reports whether e is the predeclared nil.
+func isNil(p *pass, e ast.Expr) bool {
+	id, ok := unparen(e).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = p.info.Uses[id].(*types.Nil)
+	return ok
+}
+
+// unusedFuncs are functions without side effects whose results must be used.
+var unusedFuncs = map[string]bool{
+	"errors.New":                   true,
+	"fmt.Errorf":                   true,
+	"fmt.Sprint":                   true,
+	"fmt.Sprintf":                  true,
+	"fmt.Sprintln":                 true,
+	"sort.Reverse":                 true,
+	"strings.Replace":              true,
+	"strings.ToLower":              true,
+	"strings.ToUpper":              true,
+	"strings.TrimSpace":            true,
+	"github.com/pkg/errors.New":    true,
+	"github.com/pkg/errors.Errorf": true,
+	"github.com/pkg/errors.Wrap":   true,
+	"github.com/pkg/errors.Wrapf":  true,
+}
+
+// checkUnusedResult reports calls to functions in unusedFuncs whose
+// results are discarded.
+func checkUnusedResult(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		stmt, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		call, ok := unparen(stmt.X).(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if name := funcName(p.callee(call)); unusedFuncs[name] {
+			p.reportf(call.Pos(), "result of %s call not used", name)
+		}
+		return true
+	})
+}
+
+// checkUnreachable reports the first statement following a terminating
+// statement in each block.
+func checkUnreachable(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		default:
+			return true
+		}
+		for i := 0; i+1 < len(list); i++ {
+			if !terminates(p, list[i]) {
+				continue
+			}
+			next := list[i+1]
+			switch next.(type) {
+			case *ast.LabeledStmt, *ast.EmptyStmt:
+				// may be the target of a goto.
+			default:
+				p.reportf(next.Pos(), "unreachable code")
+			}
+			break
+		}
+		return true
+	})
+}
+
+// terminates reports whether control never flows past stmt.
+func terminates(p *pass, stmt ast.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return stmt.Tok != token.FALLTHROUGH
+	case *ast.ExprStmt:
+		call, ok := unparen(stmt.X).(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := unparen(call.Fun).(*ast.Ident)
+		if !ok {
+			return false
+		}
+		_, ok = p.info.Uses[id].(*types.Builtin)
+		return ok && id.Name == "panic"
+	case *ast.ForStmt:
+		// an infinite loop without a break.
+		return stmt.Cond == nil && !hasBreak(stmt.Body)
+	}
+	return false
+}
+
+// hasBreak reports whether body contains a break statement which may exit
+// the enclosing loop.
+func hasBreak(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BranchStmt:
+			if n.Tok == token.BREAK {
+				// conservatively treat any break, including those
+				// of nested statements, as exiting the loop.
+				found = true
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,65 @@
+package bad
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"vendored"
+)
+
+type T struct {
+	A int `json:"a"`
+	B int `json:"a"`  // want `repeats json name "a"`
+	C int `json: "c"` // want `not compatible with reflect.StructTag.Get`
+}
+
+func assign(x int) int {
+	x = x // want `self-assignment of x to x`
+	return x
+}
+
+func atomics(n int64) {
+	n = atomic.AddInt64(&n, 1) // want `direct assignment to atomic value`
+}
+
+func composite() vendored.Point {
+	return vendored.Point{1, 2} // want `vendored.Point composite literal uses unkeyed fields`
+}
+
+func locks(mu sync.Mutex) { // want `parameter passes lock by value: sync.Mutex`
+	var m sync.Mutex
+	n := m // want `assignment copies lock value: sync.Mutex`
+	n.Lock()
+}
+
+func nilfunc() bool {
+	return assign == nil // want `comparison of function assign == nil is always false`
+}
+
+func printf(s string, i int) {
+	fmt.Printf("%d", s)         // want `Printf format %d has arg s of wrong type string`
+	fmt.Printf("%s %s", s)      // want `Printf format %s reads arg #2, but call has 1 arg`
+	fmt.Printf("%s", s, i)      // want `Printf call needs 1 arg\(s\) but has 2 arg\(s\)`
+	fmt.Println("%d", i)        // want `Println call has possible formatting directive %d`
+	fmt.Println("done\n")       // want `Println arg list ends with redundant newline`
+	fmt.Printf("%z", i)         // want `Printf format %z has unknown verb z`
+	fmt.Printf("%v %d%%", s, i) // ok
+}
+
+func wrap(s string, err error) {
+	_ = fmt.Errorf("%w", s)   // want `Errorf format %w has arg s of wrong type string`
+	fmt.Printf("%w", err)     // want `Printf does not support error-wrapping directive %w`
+	_ = fmt.Errorf("%w", err) // ok
+}
+
+func unreachable() int {
+	return 1
+	panic("unreachable") // want `unreachable code`
+}
+
+func unused() {
+	fmt.Sprintf("%d", 1) // want `result of fmt.Sprintf call not used`
+	errors.New("x")      // want `result of errors.New call not used`
+}
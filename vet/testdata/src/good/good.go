@@ -0,0 +1,32 @@
+package good
+
+import (
+	"fmt"
+	"sync"
+
+	"vendored"
+)
+
+type counter struct {
+	sync.Mutex
+	n int
+}
+
+func (c *counter) inc() {
+	c.Lock()
+	c.n++
+	c.Unlock()
+}
+
+func point() vendored.Point {
+	return vendored.Point{X: 1, Y: 2}
+}
+
+func describe(c *counter) string {
+	p := point()
+	return fmt.Sprintf("%d at %d,%d %v %s", c.n, p.X, p.Y, p, fmt.Errorf("oops"))
+}
+
+func wrap(err error) error {
+	return fmt.Errorf("describe: %w", err)
+}
@@ -0,0 +1,9 @@
+package good
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	if got := describe(new(counter)); got == "" {
+		t.Fatalf("describe: got %q", got)
+	}
+}
@@ -0,0 +1,252 @@
+package vet
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// checkComposites reports composite literals of struct types imported from
+// other packages which do not use field keys, as they break when fields
+// are added to the type.
+func checkComposites(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || len(lit.Elts) == 0 {
+			return true
+		}
+		if _, ok := lit.Elts[0].(*ast.KeyValueExpr); ok {
+			return true
+		}
+		named, ok := p.typeOf(lit).(*types.Named)
+		if !ok {
+			return true
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return true
+		}
+		pkg := named.Obj().Pkg()
+		if pkg == nil || pkg == p.pkg || pkg.Path()+"_test" == p.pkg.Path() {
+			return true
+		}
+		p.reportf(lit.Pos(), "%s.%s composite literal uses unkeyed fields", pkg.Name(), named.Obj().Name())
+		return true
+	})
+}
+
+// checkCopyLocks reports values containing a lock, such as a sync.Mutex,
+// which are copied by assignment, as function parameters or receivers, or
+// by range loops.
+func checkCopyLocks(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				checkCopyLocksFields(p, "receiver", n.Recv)
+			}
+			checkCopyLocksFields(p, "parameter", n.Type.Params)
+		case *ast.FuncLit:
+			checkCopyLocksFields(p, "parameter", n.Type.Params)
+		case *ast.AssignStmt:
+			for _, rhs := range n.Rhs {
+				if path := lockPath(p, rhs); path != "" {
+					p.reportf(rhs.Pos(), "assignment copies lock value: %s", path)
+				}
+			}
+		case *ast.ValueSpec:
+			for _, v := range n.Values {
+				if path := lockPath(p, v); path != "" {
+					p.reportf(v.Pos(), "variable declaration copies lock value: %s", path)
+				}
+			}
+		case *ast.CallExpr:
+			if tv, ok := p.info.Types[n.Fun]; ok && tv.IsType() {
+				// a conversion, not a call.
+				return true
+			}
+			for _, arg := range n.Args {
+				if path := lockPath(p, arg); path != "" {
+					p.reportf(arg.Pos(), "call of %s copies lock value: %s", render(p.fset, n.Fun), path)
+				}
+			}
+		case *ast.RangeStmt:
+			if n.Value == nil {
+				return true
+			}
+			if id, ok := n.Value.(*ast.Ident); ok && id.Name == "_" {
+				return true
+			}
+			if path := containsLock(p.typeOf(n.Value), nil); path != "" {
+				p.reportf(n.Value.Pos(), "range var %s copies lock: %s", render(p.fset, n.Value), path)
+			}
+		}
+		return true
+	})
+}
+
+func checkCopyLocksFields(p *pass, what string, fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		if path := containsLock(p.typeOf(field.Type), nil); path != "" {
+			p.reportf(field.Type.Pos(), "%s passes lock by value: %s", what, path)
+		}
+	}
+}
+
+// lockPath returns the path to a lock within the value of e if evaluating e
+// would copy a lock, otherwise it returns the empty string.
+func lockPath(p *pass, e ast.Expr) string {
+	switch e := unparen(e).(type) {
+	case *ast.CompositeLit, *ast.CallExpr, *ast.FuncLit:
+		// a fresh value, not a copy.
+		return ""
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return ""
+		}
+	case *ast.Ident:
+		if e.Name == "nil" {
+			return ""
+		}
+	}
+	if tv, ok := p.info.Types[e]; ok && tv.IsType() {
+		return ""
+	}
+	return containsLock(p.typeOf(e), nil)
+}
+
+// containsLock returns the path to a lock contained by value in t, or the
+// empty string if t does not contain a lock. seen guards against recursive
+// types.
+func containsLock(t types.Type, seen map[types.Type]bool) string {
+	if t == nil {
+		return ""
+	}
+	if seen == nil {
+		seen = make(map[types.Type]bool)
+	}
+	if seen[t] {
+		return ""
+	}
+	seen[t] = true
+
+	if named, ok := t.(*types.Named); ok && isLock(named) {
+		return named.String()
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if path := containsLock(u.Field(i).Type(), seen); path != "" {
+				return t.String() + " contains " + path
+			}
+		}
+	case *types.Array:
+		return containsLock(u.Elem(), seen)
+	}
+	return ""
+}
+
+// isLock reports whether t, but not a value of t, has Lock and Unlock
+// methods, as is the case for sync.Mutex.
+func isLock(t *types.Named) bool {
+	if _, ok := t.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	hasLock := func(ms *types.MethodSet) bool {
+		return ms.Lookup(t.Obj().Pkg(), "Lock") != nil && ms.Lookup(t.Obj().Pkg(), "Unlock") != nil
+	}
+	return !hasLock(types.NewMethodSet(t)) && hasLock(types.NewMethodSet(types.NewPointer(t)))
+}
+
+// checkStructTags reports struct field tags which are not in the canonical
+// form understood by reflect.StructTag.Get, and duplicate json or xml keys.
+func checkStructTags(p *pass) {
+	p.inspect(func(n ast.Node) bool {
+		st, ok := n.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		seen := make(map[string]map[string]bool) // tag key to names
+		for _, field := range st.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			if err := validateStructTag(tag); err != "" {
+				p.reportf(field.Tag.Pos(), "struct field tag %s not compatible with reflect.StructTag.Get: %s", field.Tag.Value, err)
+				continue
+			}
+			for _, key := range []string{"json", "xml"} {
+				name := strings.Split(reflect.StructTag(tag).Get(key), ",")[0]
+				if name == "" || name == "-" {
+					continue
+				}
+				if seen[key] == nil {
+					seen[key] = make(map[string]bool)
+				}
+				if seen[key][name] {
+					p.reportf(field.Tag.Pos(), "struct field tag %s repeats %s name %q", field.Tag.Value, key, name)
+				}
+				seen[key][name] = true
+			}
+		}
+		return true
+	})
+}
+
+// validateStructTag parses tag, returning a description of the problem if
+// it is not a space separated list of key:"value" pairs.
+func validateStructTag(tag string) string {
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 {
+			return "bad syntax for struct tag key"
+		}
+		if i+1 >= len(tag) || tag[i] != ':' {
+			return "bad syntax for struct tag pair"
+		}
+		if tag[i+1] != '"' {
+			return "bad syntax for struct tag value"
+		}
+		tag = tag[i+1:]
+
+		// scan the quoted value.
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return "bad syntax for struct tag value"
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return "bad syntax for struct tag value"
+		}
+		tag = tag[i+1:]
+		if tag != "" && tag[0] != ' ' {
+			return "key:\"value\" pairs not separated by spaces"
+		}
+	}
+	return ""
+}
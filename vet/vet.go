@@ -0,0 +1,123 @@
+// Package vet implements static analysis of gb project packages.
+//
+// Packages are type checked from source, with imports resolved through
+// the Context, so vet sees the same packages as the compiler: those in
+// the project, its vendor directory, the depfile cache and the standard
+// library.
+package vet
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/internal/typecheck"
+	"github.com/pkg/errors"
+)
+
+// Diagnostic is a problem reported by a check.
+type Diagnostic struct {
+	Pos     token.Position
+	Check   string // name of the check which reported the problem
+	Message string
+}
+
+// Vet runs the vet checks over the supplied packages.
+func Vet(pkgs ...*gb.Package) error {
+	vet, err := VetPackages(pkgs...)
+	if err != nil {
+		return err
+	}
+	return gb.Execute(vet)
+}
+
+// VetPackages produces a graph of Actions that when executed vet the
+// supplied packages, printing diagnostics to os.Stderr.
+func VetPackages(pkgs ...*gb.Package) (*gb.Action, error) {
+	if len(pkgs) < 1 {
+		return nil, errors.New("no vet packages provided")
+	}
+	l := typecheck.NewLoader()
+	var names []string
+	vet := gb.Action{
+		Run: func() error { return nil },
+	}
+	for _, pkg := range pkgs {
+		names = append(names, pkg.ImportPath)
+		vet.Deps = append(vet.Deps, vetPackage(l, pkg))
+	}
+	vet.Name = fmt.Sprintf("vet: %s", strings.Join(names, ","))
+	return &vet, nil
+}
+
+// vetPackage returns an Action which vets pkg.
+func vetPackage(l *typecheck.Loader, pkg *gb.Package) *gb.Action {
+	return &gb.Action{
+		Name: fmt.Sprintf("vet: %s", pkg.ImportPath),
+		Run: func() error {
+			diags, err := check(l, pkg)
+			if err != nil {
+				return err
+			}
+			report(os.Stderr, pkg.Projectdir(), diags)
+			if len(diags) > 0 {
+				return errors.Errorf("vet: %s: %d issue(s) found", pkg.ImportPath, len(diags))
+			}
+			return nil
+		},
+	}
+}
+
+// check type checks pkg, along with its internal and external tests, and
+// runs each check over the result.
+func check(l *typecheck.Loader, pkg *gb.Package) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	files := append(typecheck.GoFiles(pkg), pkg.TestGoFiles...)
+	if len(files) > 0 {
+		p, err := newPass(l, pkg, pkg.ImportPath, files)
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, p.run()...)
+	}
+	if len(pkg.XTestGoFiles) > 0 {
+		p, err := newPass(l, pkg, pkg.ImportPath+"_test", pkg.XTestGoFiles)
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, p.run()...)
+	}
+	sort.Sort(byPosition(diags))
+	return diags, nil
+}
+
+// report writes diags to w, with file names relative to root where possible.
+func report(w io.Writer, root string, diags []Diagnostic) {
+	for _, d := range diags {
+		pos := d.Pos
+		if rel, err := filepath.Rel(root, pos.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+			pos.Filename = rel
+		}
+		fmt.Fprintf(w, "%s: %s\n", pos, d.Message)
+	}
+}
+
+type byPosition []Diagnostic
+
+func (b byPosition) Len() int      { return len(b) }
+func (b byPosition) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPosition) Less(i, j int) bool {
+	pi, pj := b[i].Pos, b[j].Pos
+	if pi.Filename != pj.Filename {
+		return pi.Filename < pj.Filename
+	}
+	if pi.Line != pj.Line {
+		return pi.Line < pj.Line
+	}
+	return pi.Column < pj.Column
+}
@@ -0,0 +1,106 @@
+package vet
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/constabulary/gb"
+	"github.com/constabulary/gb/internal/typecheck"
+)
+
+func testContext(t *testing.T) *gb.Context {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := gb.NewContext(gb.NewProject(filepath.Join(cwd, "testdata")), gb.GcToolchain())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// wants returns the expected diagnostics, recorded in // want `regexp`
+// comments, for each line of the file at path.
+func wants(t *testing.T, path string) map[int]*regexp.Regexp {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make(map[int]*regexp.Regexp)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		i := strings.Index(sc.Text(), "// want `")
+		if i < 0 {
+			continue
+		}
+		want[line] = regexp.MustCompile(strings.TrimSuffix(sc.Text()[i+len("// want `"):], "`"))
+	}
+	return want
+}
+
+func TestCheck(t *testing.T) {
+	tests := []string{"good", "bad"}
+
+	ctx := testContext(t)
+	defer ctx.Destroy()
+	for _, path := range tests {
+		pkg, err := ctx.ResolvePackage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diags, err := check(typecheck.NewLoader(), pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := make(map[string]map[int]*regexp.Regexp)
+		for _, name := range append(typecheck.GoFiles(pkg), pkg.TestGoFiles...) {
+			file := filepath.Join(pkg.Dir, name)
+			want[file] = wants(t, file)
+		}
+		for _, d := range diags {
+			re, ok := want[d.Pos.Filename][d.Pos.Line]
+			if !ok {
+				t.Errorf("%s: unexpected %s diagnostic: %s", d.Pos, d.Check, d.Message)
+				continue
+			}
+			if !re.MatchString(d.Message) {
+				t.Errorf("%s: %s diagnostic %q does not match %q", d.Pos, d.Check, d.Message, re)
+			}
+			delete(want[d.Pos.Filename], d.Pos.Line)
+		}
+		for file, lines := range want {
+			for line, re := range lines {
+				t.Errorf("%s:%d: expected diagnostic matching %q", file, line, re)
+			}
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	diags := []Diagnostic{{
+		Message: "inside",
+	}, {
+		Message: "outside",
+	}}
+	diags[0].Pos.Filename = filepath.Join("project", "src", "a", "a.go")
+	diags[0].Pos.Line = 7
+	diags[0].Pos.Column = 2
+	diags[1].Pos.Filename = filepath.Join("elsewhere", "b.go")
+	diags[1].Pos.Line = 3
+	diags[1].Pos.Column = 1
+
+	var buf bytes.Buffer
+	report(&buf, "project", diags)
+	want := filepath.Join("src", "a", "a.go") + ":7:2: inside\n" + filepath.Join("elsewhere", "b.go") + ":3:1: outside\n"
+	if got := buf.String(); got != want {
+		t.Errorf("report: want %q, got %q", want, got)
+	}
+}